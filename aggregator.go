@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Aggregator turns all scores of a talent into the single score the talent is ranked by.
+type Aggregator interface {
+	// Aggregate returns the TalentScore that represents the talent in the leaderboard. Its Score is the ranking score.
+	// When the ranking score is derived from several scores, Skill and EventID are left empty.
+	// Returns false if there are no scores.
+	Aggregate(scores []TalentScore) (TalentScore, bool)
+}
+
+type AggregationStrategy string
+
+const (
+	AggregationMax             AggregationStrategy = "max"
+	AggregationSumOfSkillBests AggregationStrategy = "sum_of_skill_bests"
+	AggregationAverage         AggregationStrategy = "average"
+	AggregationLatest          AggregationStrategy = "latest"
+	AggregationBestNAverage    AggregationStrategy = "best_n_average"
+	AggregationWeighted        AggregationStrategy = "weighted"
+)
+
+type AggregatorConfig struct {
+	Strategy AggregationStrategy
+	// N is the number of best scores to average, only used by best_n_average
+	N int
+	// Weights is the weight of each skill's best score, only used by weighted. Skills without a weight are ignored.
+	Weights map[Skill]float64
+}
+
+func NewAggregator(cfg AggregatorConfig) (Aggregator, error) {
+	switch cfg.Strategy {
+	case AggregationMax, "":
+		return MaxAggregator{}, nil
+	case AggregationSumOfSkillBests:
+		return SumOfSkillBestsAggregator{}, nil
+	case AggregationAverage:
+		return AverageAggregator{}, nil
+	case AggregationLatest:
+		return LatestAggregator{}, nil
+	case AggregationBestNAverage:
+		if cfg.N <= 0 {
+			return nil, fmt.Errorf("best_n_average aggregation requires a positive N")
+		}
+		return BestNAverageAggregator{N: cfg.N}, nil
+	case AggregationWeighted:
+		if len(cfg.Weights) == 0 {
+			return nil, fmt.Errorf("weighted aggregation requires skill weights")
+		}
+		return WeightedAggregator{Weights: cfg.Weights}, nil
+	}
+	return nil, fmt.Errorf("unknown aggregation strategy %q, must be one of: max, sum_of_skill_bests, average, latest, best_n_average, weighted", cfg.Strategy)
+}
+
+// ParseSkillWeights parses weights in the "dribble=1,shoot=2.5" format
+func ParseSkillWeights(s string) (map[Skill]float64, error) {
+	weights := make(map[Skill]float64)
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid skill weight %q, must be skill=weight", pair)
+		}
+		skill := Skill(name)
+		if !skill.IsValid() {
+			return nil, fmt.Errorf("invalid skill %q in skill weights", name)
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight for skill %s: %w", skill, err)
+		}
+		weights[skill] = weight
+	}
+	return weights, nil
+}
+
+// MaxAggregator ranks a talent by its single best score
+type MaxAggregator struct{}
+
+func (MaxAggregator) Aggregate(scores []TalentScore) (TalentScore, bool) {
+	if len(scores) == 0 {
+		return TalentScore{}, false
+	}
+
+	best := scores[0]
+	for _, score := range scores[1:] {
+		if achievedBefore(score, best) {
+			best = score
+		}
+	}
+	return best, true
+}
+
+// SumOfSkillBestsAggregator ranks a talent by the sum of its best score in each skill
+type SumOfSkillBestsAggregator struct{}
+
+func (SumOfSkillBestsAggregator) Aggregate(scores []TalentScore) (TalentScore, bool) {
+	if len(scores) == 0 {
+		return TalentScore{}, false
+	}
+
+	sum := 0
+	for _, best := range bestScorePerSkill(scores) {
+		sum += best.Score
+	}
+	return compositeTalentScore(scores, sum), true
+}
+
+// AverageAggregator ranks a talent by the average of all its scores, rounded to the nearest integer
+type AverageAggregator struct{}
+
+func (AverageAggregator) Aggregate(scores []TalentScore) (TalentScore, bool) {
+	if len(scores) == 0 {
+		return TalentScore{}, false
+	}
+	return compositeTalentScore(scores, averageScore(scores)), true
+}
+
+// LatestAggregator ranks a talent by the score with the latest event timestamp, so events that arrive out of order
+// don't replace a newer score. Scores with the same timestamp are ordered by event ID.
+type LatestAggregator struct{}
+
+func (LatestAggregator) Aggregate(scores []TalentScore) (TalentScore, bool) {
+	if len(scores) == 0 {
+		return TalentScore{}, false
+	}
+	latest := scores[0]
+	for _, score := range scores[1:] {
+		if score.Timestamp.After(latest.Timestamp) ||
+			(score.Timestamp.Equal(latest.Timestamp) && score.EventID > latest.EventID) {
+			latest = score
+		}
+	}
+	return latest, true
+}
+
+// BestNAverageAggregator ranks a talent by the average of its N best scores.
+// Talents with fewer than N scores are ranked by the average of the scores they have.
+type BestNAverageAggregator struct {
+	N int
+}
+
+func (a BestNAverageAggregator) Aggregate(scores []TalentScore) (TalentScore, bool) {
+	if len(scores) == 0 {
+		return TalentScore{}, false
+	}
+
+	sorted := append([]TalentScore(nil), scores...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Score > sorted[j].Score })
+	if len(sorted) > a.N {
+		sorted = sorted[:a.N]
+	}
+
+	if len(sorted) == 1 {
+		return sorted[0], true
+	}
+	return compositeTalentScore(scores, averageScore(sorted)), true
+}
+
+// WeightedAggregator ranks a talent by the weighted sum of its best score in each skill, rounded to the nearest integer
+type WeightedAggregator struct {
+	Weights map[Skill]float64
+}
+
+func (a WeightedAggregator) Aggregate(scores []TalentScore) (TalentScore, bool) {
+	if len(scores) == 0 {
+		return TalentScore{}, false
+	}
+
+	var sum float64
+	for skill, best := range bestScorePerSkill(scores) {
+		sum += a.Weights[skill] * float64(best.Score)
+	}
+	return compositeTalentScore(scores, int(math.Round(sum))), true
+}
+
+func bestScorePerSkill(scores []TalentScore) map[Skill]TalentScore {
+	bests := make(map[Skill]TalentScore)
+	for _, score := range scores {
+		if best, ok := bests[score.Skill]; !ok || achievedBefore(score, best) {
+			bests[score.Skill] = score
+		}
+	}
+	return bests
+}
+
+func averageScore(scores []TalentScore) int {
+	sum := 0
+	for _, score := range scores {
+		sum += score.Score
+	}
+	return int(math.Round(float64(sum) / float64(len(scores))))
+}
+
+// achievedBefore reports whether a is a better score than b, or the same score achieved earlier
+func achievedBefore(a, b TalentScore) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Timestamp.Before(b.Timestamp)
+}
+
+// compositeTalentScore is a TalentScore that's not tied to a single skill or event.
+// It's achieved at the time of the latest of the scores it's derived from.
+func compositeTalentScore(scores []TalentScore, score int) TalentScore {
+	composite := TalentScore{
+		TalentID: scores[0].TalentID,
+		Score:    score,
+	}
+	for _, s := range scores {
+		if s.Timestamp.After(composite.Timestamp) {
+			composite.Timestamp = s.Timestamp
+		}
+	}
+	return composite
+}
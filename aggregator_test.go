@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregators(t *testing.T) {
+	scores := []TalentScore{
+		{TalentID: "talent-1", Skill: SkillDribble, Score: 40, EventID: "event-1"},
+		{TalentID: "talent-1", Skill: SkillShoot, Score: 90, EventID: "event-2"},
+		{TalentID: "talent-1", Skill: SkillDribble, Score: 60, EventID: "event-3"},
+		{TalentID: "talent-1", Skill: SkillPass, Score: 25, EventID: "event-4"},
+	}
+
+	tests := []struct {
+		name     string
+		config   AggregatorConfig
+		expected TalentScore
+	}{
+		{
+			name:     "max picks the single best score",
+			config:   AggregatorConfig{Strategy: AggregationMax},
+			expected: scores[1],
+		},
+		{
+			name:     "sum of skill bests adds up the best score of each skill",
+			config:   AggregatorConfig{Strategy: AggregationSumOfSkillBests},
+			expected: TalentScore{TalentID: "talent-1", Score: 60 + 90 + 25},
+		},
+		{
+			name:     "average rounds the mean of all scores",
+			config:   AggregatorConfig{Strategy: AggregationAverage},
+			expected: TalentScore{TalentID: "talent-1", Score: 54}, // 215 / 4 = 53.75
+		},
+		{
+			name:     "latest breaks a timestamp tie by event ID",
+			config:   AggregatorConfig{Strategy: AggregationLatest},
+			expected: scores[3],
+		},
+		{
+			name:     "best n average averages the n best scores",
+			config:   AggregatorConfig{Strategy: AggregationBestNAverage, N: 2},
+			expected: TalentScore{TalentID: "talent-1", Score: 75},
+		},
+		{
+			name:     "best n average with a single score returns it as is",
+			config:   AggregatorConfig{Strategy: AggregationBestNAverage, N: 1},
+			expected: scores[1],
+		},
+		{
+			name:     "weighted sums the weighted skill bests and ignores skills without a weight",
+			config:   AggregatorConfig{Strategy: AggregationWeighted, Weights: map[Skill]float64{SkillDribble: 0.5, SkillShoot: 2}},
+			expected: TalentScore{TalentID: "talent-1", Score: 30 + 180},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregator, err := NewAggregator(tt.config)
+			require.NoError(t, err)
+
+			talentScore, ok := aggregator.Aggregate(scores)
+			require.True(t, ok)
+			assert.Equal(t, tt.expected, talentScore)
+
+			_, ok = aggregator.Aggregate(nil)
+			assert.False(t, ok)
+		})
+	}
+
+	t.Run("invalid configs are rejected", func(t *testing.T) {
+		_, err := NewAggregator(AggregatorConfig{Strategy: "median"})
+		assert.Error(t, err)
+		_, err = NewAggregator(AggregatorConfig{Strategy: AggregationBestNAverage})
+		assert.Error(t, err)
+		_, err = NewAggregator(AggregatorConfig{Strategy: AggregationWeighted})
+		assert.Error(t, err)
+	})
+
+	t.Run("latest picks the score with the latest timestamp, not the last saved one", func(t *testing.T) {
+		now := time.Now()
+		outOfOrder := []TalentScore{
+			{TalentID: "talent-1", Skill: SkillDribble, Score: 40, EventID: "event-1", Timestamp: now.Add(-time.Minute)},
+			{TalentID: "talent-1", Skill: SkillDribble, Score: 60, EventID: "event-2", Timestamp: now},
+			{TalentID: "talent-1", Skill: SkillDribble, Score: 90, EventID: "event-0", Timestamp: now.Add(-time.Hour)},
+		}
+
+		talentScore, ok := LatestAggregator{}.Aggregate(outOfOrder)
+		require.True(t, ok)
+		assert.Equal(t, outOfOrder[1], talentScore)
+	})
+
+	t.Run("parse skill weights", func(t *testing.T) {
+		weights, err := ParseSkillWeights("dribble=1, shoot=2.5")
+		require.NoError(t, err)
+		assert.Equal(t, map[Skill]float64{SkillDribble: 1, SkillShoot: 2.5}, weights)
+
+		_, err = ParseSkillWeights("juggle=1")
+		assert.Error(t, err)
+	})
+}
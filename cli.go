@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage:
+  cuju                            start the server
+  cuju snapshot list              list snapshots of the file storage in CUJU_DATA_DIR
+  cuju snapshot create            take a snapshot and compact the log
+  cuju snapshot verify <id>       check that a snapshot is readable and not corrupted
+  cuju snapshot restore <id>      replace the current state with the given snapshot
+  cuju ingest [-url URL] <file>   stream the events of a .jsonl file to POST /events/stream of a running server
+                                  (default URL is http://localhost:8080)`
+
+// runCommand runs a CLI subcommand instead of starting the server
+func runCommand(cfg Config, args []string) error {
+	switch args[0] {
+	case "snapshot":
+		return runSnapshotCommand(cfg, args[1:])
+	case "ingest":
+		return runIngestCommand(args[1:])
+	}
+	return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+}
+
+// runSnapshotCommand manages the snapshots of the file storage.
+// It fails with ErrDataDirLocked while the server is using the same data dir.
+func runSnapshotCommand(cfg Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing snapshot command\n%s", usage)
+	}
+
+	// Periodic snapshots are disabled, only the explicitly requested ones are taken
+	cfg.SnapshotInterval = 0
+	storage, err := openFileStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	switch args[0] {
+	case "list":
+		snapshots, err := storage.ListSnapshots()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED AT\tSIZE")
+		for _, snapshot := range snapshots {
+			fmt.Fprintf(w, "%d\t%s\t%d\n", snapshot.ID, snapshot.CreatedAt.Format(time.RFC3339), snapshot.Size)
+		}
+		return w.Flush()
+
+	case "create":
+		snapshot, err := storage.Snapshot()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Snapshot %d created\n", snapshot.ID)
+		return nil
+
+	case "verify", "restore":
+		if len(args) != 2 {
+			return fmt.Errorf("missing snapshot id\n%s", usage)
+		}
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid snapshot id %q", args[1])
+		}
+
+		if args[0] == "verify" {
+			if _, err := storage.VerifySnapshot(id); err != nil {
+				return err
+			}
+			fmt.Printf("Snapshot %d is valid\n", id)
+			return nil
+		}
+
+		snapshot, err := storage.RestoreSnapshot(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Snapshot %d restored, current state saved as snapshot %d\n", id, snapshot.ID)
+		return nil
+	}
+
+	return fmt.Errorf("unknown snapshot command %q\n%s", args[0], usage)
+}
+
+// runIngestCommand streams a file of newline-delimited events to a running server.
+// It goes through the same endpoint as any other client, so events are validated, deduplicated and processed the same way.
+func runIngestCommand(args []string) error {
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	url := flags.String("url", "http://localhost:8080", "base URL of the server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("missing file\n%s", usage)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ingestEvents(*url, file, os.Stdout, os.Stderr)
+}
+
+// ingestEvents streams the NDJSON events to the server at url. It reports the invalid and conflicting events to errOut,
+// and the summary of the results to out.
+func ingestEvents(url string, events io.Reader, out, errOut io.Writer) error {
+	resp, err := http.Post(strings.TrimSuffix(url, "/")+"/events/stream", "application/x-ndjson", events)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("server responded with %s: %s", resp.Status, errResp.Message)
+	}
+
+	var accepted, duplicates, conflicts, invalid int
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var line struct {
+			BatchEventResult
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		if err := decoder.Decode(&line); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("read results: %w", err)
+		}
+
+		if line.Error != "" {
+			return fmt.Errorf("ingest stopped after %d events: %s: %s", accepted+duplicates+conflicts+invalid, line.Error, line.Message)
+		}
+		switch line.Status {
+		case BatchEventAccepted:
+			accepted++
+		case BatchEventDuplicate:
+			duplicates++
+		case BatchEventConflict:
+			conflicts++
+			fmt.Fprintf(errOut, "event %d (%s) conflicts with a stored event: %s\n", line.Index, line.EventID, line.Reason)
+		case BatchEventInvalid:
+			invalid++
+			fmt.Fprintf(errOut, "event %d (%s) is invalid: %s\n", line.Index, line.EventID, line.Reason)
+		}
+	}
+
+	fmt.Fprintf(out, "%d accepted, %d duplicates, %d conflicts, %d invalid\n", accepted, duplicates, conflicts, invalid)
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestEvents(t *testing.T) {
+	t.Run("reports invalid and conflicting events, and prints a summary", func(t *testing.T) {
+		server, _ := newTestServer(t, HTTPOptions{})
+
+		events := strings.Join([]string{
+			testEventJSON("event-1", 10),
+			testEventJSON("event-2", 20),
+			testEventJSON("event-1", 10),
+			testEventJSON("event-2", 30),
+			`{"event_id":"event-3","talent_id":"talent-1","raw_metric":50,"skill":"juggle","ts":"2025-01-01T10:00:00Z"}`,
+		}, "\n") + "\n"
+
+		var out, errOut bytes.Buffer
+		require.NoError(t, ingestEvents(server.URL+"/", strings.NewReader(events), &out, &errOut))
+
+		assert.Equal(t, "2 accepted, 1 duplicates, 1 conflicts, 1 invalid\n", out.String())
+		assert.Contains(t, errOut.String(), "event 3 (event-2) conflicts with a stored event")
+		assert.Contains(t, errOut.String(), "event 4 (event-3) is invalid: skill:")
+	})
+
+	t.Run("fails when the server stops the stream", func(t *testing.T) {
+		server, _ := newTestServer(t, HTTPOptions{})
+
+		events := testEventJSON("event-1", 10) + "\n" + strings.Repeat("a", maxStreamLineBytes+1) + "\n"
+
+		var out, errOut bytes.Buffer
+		err := ingestEvents(server.URL, strings.NewReader(events), &out, &errOut)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ingest stopped after 1 events: Failed to read stream")
+		assert.Empty(t, out.String())
+	})
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type StorageType string
+
+const (
+	StorageTypeMemory StorageType = "memory"
+	StorageTypeFile   StorageType = "file"
+)
+
+// Config is the application configuration, read from CUJU_* environment variables.
+type Config struct {
+	// CUJU_STORAGE: memory (default) or file
+	StorageType StorageType
+	// CUJU_LEADERBOARD_MODE: periodic (default) or realtime
+	LeaderboardMode LeaderboardMode
+	// CUJU_RANK_MODE: how tied talents are ranked, ordinal (default, 1,2,3,4), competition (1,2,2,4) or dense (1,2,2,3)
+	RankMode RankMode
+	// CUJU_AGGREGATION: how a talent's scores are turned into its ranking score, one of
+	// max (default), sum_of_skill_bests, average, latest, best_n_average or weighted.
+	// CUJU_AGGREGATION_N sets N of best_n_average, and CUJU_AGGREGATION_WEIGHTS sets the weights
+	// of weighted in the "dribble=1,shoot=2,pass=1.5" format.
+	Aggregation AggregatorConfig
+	// CUJU_TIMEZONE: IANA timezone that daily, weekly and monthly leaderboards follow, e.g. Europe/Berlin (default is UTC)
+	Location *time.Location
+	// CUJU_EXACT_RANK_LIMIT: /rank returns exact ranks up to this rank, and a rank bucket like "10000+" below it,
+	// 0 makes all ranks exact (default is 10000)
+	ExactRankLimit int
+	// CUJU_RANK_HISTORY_INTERVAL: how often the ranks of all talents are recorded for their rank history, e.g. 24h,
+	// 0 disables it (default is 1h)
+	RankHistoryInterval time.Duration
+	// CUJU_RANK_HISTORY_RETENTION: how long recorded ranks are kept, e.g. 720h, 0 keeps them forever (default is 2160h, 90 days)
+	RankHistoryRetention time.Duration
+	// CUJU_WORKERS: number of events scored in parallel, the events of a talent are still scored in order (default is 8)
+	Workers int
+	// CUJU_WORKER_ID: identifies this instance when it claims events, it must be unique among the instances sharing
+	// a storage (default is the host name and the process ID)
+	WorkerID string
+	// CUJU_LEASE_TIMEOUT: how long claimed events are hidden from other workers before they can be claimed again,
+	// it should be longer than scoring a batch takes (default is 1m)
+	LeaseTimeout time.Duration
+	// CUJU_MAX_ATTEMPTS: number of failed processing attempts after which an event is dead-lettered (default is 5)
+	MaxAttempts int
+	// Retry is the backoff of failed events:
+	// CUJU_RETRY_BASE_DELAY: delay after the first failed attempt, 0 retries right away (default is 1s)
+	// CUJU_RETRY_MAX_DELAY: cap of the delay, 0 means no cap (default is 5m)
+	// CUJU_RETRY_JITTER: fraction of the delay between 0 and 1 that is randomly taken off it (default is 0.2)
+	Retry RetryPolicy
+	// Validation is the rules incoming events are checked against:
+	// CUJU_ID_PATTERN: regular expression event and talent IDs must match (default is ^[A-Za-z0-9._:-]{1,128}$)
+	// CUJU_METRIC_RANGES: raw metric range per skill in the "dribble=0-1000,shoot=0-500" format (default is 0-1000000)
+	// CUJU_MAX_FUTURE_SKEW: how far in the future an event timestamp may be (default is 5m)
+	// CUJU_MAX_EVENT_AGE: how far in the past an event timestamp may be, 0 allows any age (default is 0)
+	// CUJU_STRICT_JSON: whether events with unknown fields are rejected (default is true)
+	Validation ValidationRules
+	// CUJU_ADMIN_TOKEN: bearer token required by admin endpoints, they're disabled if it's empty
+	AdminToken string
+	// CUJU_ADMIN_OPEN: opens the admin endpoints to everyone when there's no admin token, e.g. for local development
+	// (default is false)
+	AdminOpen bool
+	// CUJU_DATA_DIR: directory of the file storage (default is ./data)
+	DataDir string
+	// CUJU_FSYNC: always (default), interval or never
+	SyncPolicy SyncPolicy
+	// CUJU_FSYNC_INTERVAL: fsync interval for the interval policy, e.g. 200ms (default is 1s)
+	SyncInterval time.Duration
+	// CUJU_SNAPSHOT_INTERVAL: how often the file storage takes a snapshot and compacts its log, 0 disables it (default is 5m)
+	SnapshotInterval time.Duration
+	// CUJU_SNAPSHOT_RETAIN: number of snapshots to keep (default is 3)
+	SnapshotRetain int
+}
+
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		StorageType:          StorageTypeMemory,
+		LeaderboardMode:      LeaderboardModePeriodic,
+		RankMode:             RankModeOrdinal,
+		Aggregation:          AggregatorConfig{Strategy: AggregationMax},
+		Location:             time.UTC,
+		ExactRankLimit:       10000,
+		RankHistoryInterval:  1 * time.Hour,
+		RankHistoryRetention: 90 * 24 * time.Hour,
+		Workers:              8,
+		LeaseTimeout:         1 * time.Minute,
+		MaxAttempts:          5,
+		Retry: RetryPolicy{
+			BaseDelay: 1 * time.Second,
+			MaxDelay:  5 * time.Minute,
+			Jitter:    0.2,
+		},
+		Validation: ValidationRules{
+			IDPattern:     DefaultIDPattern,
+			MaxFutureSkew: 5 * time.Minute,
+			StrictJSON:    true,
+		},
+		DataDir:          "./data",
+		SyncPolicy:       SyncAlways,
+		SyncInterval:     1 * time.Second,
+		SnapshotInterval: 5 * time.Minute,
+		SnapshotRetain:   3,
+	}
+
+	if v := os.Getenv("CUJU_STORAGE"); v != "" {
+		cfg.StorageType = StorageType(v)
+		if cfg.StorageType != StorageTypeMemory && cfg.StorageType != StorageTypeFile {
+			return Config{}, fmt.Errorf("CUJU_STORAGE must be one of: memory, file")
+		}
+	}
+
+	if v := os.Getenv("CUJU_LEADERBOARD_MODE"); v != "" {
+		mode, err := ParseLeaderboardMode(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("CUJU_LEADERBOARD_MODE: %w", err)
+		}
+		cfg.LeaderboardMode = mode
+	}
+
+	if v := os.Getenv("CUJU_RANK_MODE"); v != "" {
+		mode, err := ParseRankMode(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("CUJU_RANK_MODE: %w", err)
+		}
+		cfg.RankMode = mode
+	}
+
+	if v := os.Getenv("CUJU_AGGREGATION"); v != "" {
+		cfg.Aggregation.Strategy = AggregationStrategy(v)
+	}
+	if v := os.Getenv("CUJU_AGGREGATION_N"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("CUJU_AGGREGATION_N must be an integer")
+		}
+		cfg.Aggregation.N = n
+	}
+	if v := os.Getenv("CUJU_AGGREGATION_WEIGHTS"); v != "" {
+		weights, err := ParseSkillWeights(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("CUJU_AGGREGATION_WEIGHTS: %w", err)
+		}
+		cfg.Aggregation.Weights = weights
+	}
+	if _, err := NewAggregator(cfg.Aggregation); err != nil {
+		return Config{}, fmt.Errorf("CUJU_AGGREGATION: %w", err)
+	}
+
+	if v := os.Getenv("CUJU_TIMEZONE"); v != "" {
+		location, err := time.LoadLocation(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("CUJU_TIMEZONE: %w", err)
+		}
+		cfg.Location = location
+	}
+
+	if v := os.Getenv("CUJU_EXACT_RANK_LIMIT"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return Config{}, fmt.Errorf("CUJU_EXACT_RANK_LIMIT must be a non-negative integer")
+		}
+		cfg.ExactRankLimit = limit
+	}
+
+	if v := os.Getenv("CUJU_RANK_HISTORY_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < 0 {
+			return Config{}, fmt.Errorf("CUJU_RANK_HISTORY_INTERVAL must be a non-negative duration")
+		}
+		cfg.RankHistoryInterval = interval
+	}
+
+	if v := os.Getenv("CUJU_RANK_HISTORY_RETENTION"); v != "" {
+		retention, err := time.ParseDuration(v)
+		if err != nil || retention < 0 {
+			return Config{}, fmt.Errorf("CUJU_RANK_HISTORY_RETENTION must be a non-negative duration")
+		}
+		cfg.RankHistoryRetention = retention
+	}
+
+	if v := os.Getenv("CUJU_WORKERS"); v != "" {
+		workers, err := strconv.Atoi(v)
+		if err != nil || workers <= 0 {
+			return Config{}, fmt.Errorf("CUJU_WORKERS must be a positive integer")
+		}
+		cfg.Workers = workers
+	}
+
+	cfg.WorkerID = os.Getenv("CUJU_WORKER_ID")
+
+	if v := os.Getenv("CUJU_LEASE_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return Config{}, fmt.Errorf("CUJU_LEASE_TIMEOUT must be a positive duration")
+		}
+		cfg.LeaseTimeout = timeout
+	}
+
+	if v := os.Getenv("CUJU_MAX_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts <= 0 {
+			return Config{}, fmt.Errorf("CUJU_MAX_ATTEMPTS must be a positive integer")
+		}
+		cfg.MaxAttempts = attempts
+	}
+
+	if v := os.Getenv("CUJU_RETRY_BASE_DELAY"); v != "" {
+		delay, err := time.ParseDuration(v)
+		if err != nil || delay < 0 {
+			return Config{}, fmt.Errorf("CUJU_RETRY_BASE_DELAY must be a non-negative duration")
+		}
+		cfg.Retry.BaseDelay = delay
+	}
+
+	if v := os.Getenv("CUJU_RETRY_MAX_DELAY"); v != "" {
+		delay, err := time.ParseDuration(v)
+		if err != nil || delay < 0 {
+			return Config{}, fmt.Errorf("CUJU_RETRY_MAX_DELAY must be a non-negative duration")
+		}
+		cfg.Retry.MaxDelay = delay
+	}
+
+	if v := os.Getenv("CUJU_RETRY_JITTER"); v != "" {
+		jitter, err := strconv.ParseFloat(v, 64)
+		if err != nil || jitter < 0 || jitter > 1 {
+			return Config{}, fmt.Errorf("CUJU_RETRY_JITTER must be a number between 0 and 1")
+		}
+		cfg.Retry.Jitter = jitter
+	}
+
+	if v := os.Getenv("CUJU_ID_PATTERN"); v != "" {
+		pattern, err := regexp.Compile(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("CUJU_ID_PATTERN: %w", err)
+		}
+		cfg.Validation.IDPattern = pattern
+	}
+
+	if v := os.Getenv("CUJU_METRIC_RANGES"); v != "" {
+		ranges, err := ParseMetricRanges(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("CUJU_METRIC_RANGES: %w", err)
+		}
+		cfg.Validation.MetricRanges = ranges
+	}
+
+	if v := os.Getenv("CUJU_MAX_FUTURE_SKEW"); v != "" {
+		skew, err := time.ParseDuration(v)
+		if err != nil || skew <= 0 {
+			return Config{}, fmt.Errorf("CUJU_MAX_FUTURE_SKEW must be a positive duration")
+		}
+		cfg.Validation.MaxFutureSkew = skew
+	}
+
+	if v := os.Getenv("CUJU_MAX_EVENT_AGE"); v != "" {
+		age, err := time.ParseDuration(v)
+		if err != nil || age < 0 {
+			return Config{}, fmt.Errorf("CUJU_MAX_EVENT_AGE must be a non-negative duration")
+		}
+		cfg.Validation.MaxEventAge = age
+	}
+
+	if v := os.Getenv("CUJU_STRICT_JSON"); v != "" {
+		strict, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("CUJU_STRICT_JSON must be true or false")
+		}
+		cfg.Validation.StrictJSON = strict
+	}
+
+	cfg.AdminToken = os.Getenv("CUJU_ADMIN_TOKEN")
+
+	if v := os.Getenv("CUJU_ADMIN_OPEN"); v != "" {
+		open, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("CUJU_ADMIN_OPEN must be true or false")
+		}
+		if open && cfg.AdminToken != "" {
+			return Config{}, fmt.Errorf("CUJU_ADMIN_OPEN can't be combined with CUJU_ADMIN_TOKEN")
+		}
+		cfg.AdminOpen = open
+	}
+
+	if v := os.Getenv("CUJU_DATA_DIR"); v != "" {
+		cfg.DataDir = v
+	}
+
+	if v := os.Getenv("CUJU_FSYNC"); v != "" {
+		policy, err := ParseSyncPolicy(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("CUJU_FSYNC: %w", err)
+		}
+		cfg.SyncPolicy = policy
+	}
+
+	if v := os.Getenv("CUJU_FSYNC_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return Config{}, fmt.Errorf("CUJU_FSYNC_INTERVAL must be a positive duration")
+		}
+		cfg.SyncInterval = interval
+	}
+
+	if v := os.Getenv("CUJU_SNAPSHOT_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < 0 {
+			return Config{}, fmt.Errorf("CUJU_SNAPSHOT_INTERVAL must be a non-negative duration")
+		}
+		cfg.SnapshotInterval = interval
+	}
+
+	if v := os.Getenv("CUJU_SNAPSHOT_RETAIN"); v != "" {
+		retain, err := strconv.Atoi(v)
+		if err != nil || retain <= 0 {
+			return Config{}, fmt.Errorf("CUJU_SNAPSHOT_RETAIN must be a positive integer")
+		}
+		cfg.SnapshotRetain = retain
+	}
+
+	return cfg, nil
+}
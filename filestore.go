@@ -0,0 +1,599 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrDataDirLocked is returned when the data dir is already used by another FileStorage, e.g. of the running server
+var ErrDataDirLocked = errors.New("data dir is used by another process")
+
+type FileStorageOptions struct {
+	// InMem configures the underlying InMemStorage
+	InMem InMemStorageOptions
+	WAL   WALOptions
+	// SnapshotInterval is how often a snapshot is taken and the log compacted. Zero disables periodic snapshots.
+	SnapshotInterval time.Duration
+	// SnapshotRetain is the number of most recent snapshots to keep (default is 3)
+	SnapshotRetain int
+}
+
+// FileStorage is a durable Storage. Every mutation is appended to a write-ahead log before it's applied
+// to the embedded InMemStorage, and the log is replayed on startup to rebuild the in-memory state.
+// Reads are served by the InMemStorage as is.
+//
+// To keep recovery time bounded, the state is periodically written to a snapshot
+// and the log segments that are fully covered by it are removed.
+// On startup the latest snapshot is loaded and only the log written after it is replayed.
+type FileStorage struct {
+	*InMemStorage
+
+	opts FileStorageOptions
+	// lock is the locked dir/LOCK file, that keeps other processes from writing to the same log
+	lock *os.File
+
+	// mu serializes mutations, so the order of records in the log is the order they were applied in memory.
+	mu  sync.Mutex
+	wal *WAL
+	// appliedLSN is the LSN of the last record applied during recovery
+	appliedLSN uint64
+
+	// snapshotMu serializes taking, restoring and pruning snapshots
+	snapshotMu sync.Mutex
+	snapshots  *snapshotStore
+
+	stopSnapshots chan struct{}
+	snapshotsDone chan struct{}
+}
+
+// NewFileStorage opens (or creates) the storage in dir, loads the latest snapshot and replays the log after it.
+// The log is kept in dir/wal and snapshots in dir/snapshots.
+// Returns ErrDataDirLocked if another FileStorage has dir open, so e.g. the snapshot command can't corrupt the log
+// of the running server.
+func NewFileStorage(dir string, opts FileStorageOptions) (*FileStorage, error) {
+	if opts.SnapshotRetain <= 0 {
+		opts.SnapshotRetain = 3
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	lock, err := lockFile(filepath.Join(dir, "LOCK"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	s, err := newLockedFileStorage(dir, opts)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	s.lock = lock
+	return s, nil
+}
+
+// newLockedFileStorage opens the storage in dir, once it holds the lock of dir
+func newLockedFileStorage(dir string, opts FileStorageOptions) (*FileStorage, error) {
+	snapshots, err := newSnapshotStore(filepath.Join(dir, "snapshots"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStorage{
+		InMemStorage: NewInMemStorageWithOptions(opts.InMem),
+		opts:         opts,
+		snapshots:    snapshots,
+	}
+
+	if err := s.loadLatestSnapshot(); err != nil {
+		s.InMemStorage.Close()
+		return nil, err
+	}
+
+	wal, err := OpenWAL(filepath.Join(dir, "wal"), opts.WAL, s.replay)
+	if err != nil {
+		s.InMemStorage.Close()
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	if err := wal.SkipTo(s.appliedLSN); err != nil {
+		wal.Close()
+		s.InMemStorage.Close()
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	s.wal = wal
+
+	// Don't wait for the next tick to serve the recovered leaderboard
+	s.refreshLeaderboard()
+
+	if opts.SnapshotInterval > 0 {
+		s.stopSnapshots = make(chan struct{})
+		s.snapshotsDone = make(chan struct{})
+		go s.startPeriodicSnapshot(opts.SnapshotInterval)
+	}
+
+	return s, nil
+}
+
+// SaveScoreEvent logs and stores a score event
+// Returns true if the event was saved, false if it was a duplicate
+func (s *FileStorage) SaveScoreEvent(ctx context.Context, event ScoreEvent) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scoreEventsMu.Lock()
+	defer s.scoreEventsMu.Unlock()
+
+	switch s.compareScoreEvent(event) {
+	case SaveResultDuplicate:
+		return false, nil
+	case SaveResultConflict:
+		return false, ErrScoreEventConflict
+	}
+
+	if _, err := s.wal.Append(walRecord{Type: walRecordScoreEvent, ScoreEvent: &event}); err != nil {
+		return false, err
+	}
+
+	s.saveScoreEvent(event)
+	return true, nil
+}
+
+// SaveScoreEvents logs the new events of the batch in a single record and stores them.
+// The batch is checked and saved under a single hold of scoreEventsMu, so the logged events are exactly the saved ones.
+func (s *FileStorage) SaveScoreEvents(ctx context.Context, events []ScoreEvent) ([]SaveResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scoreEventsMu.Lock()
+	defer s.scoreEventsMu.Unlock()
+
+	results := s.compareScoreEvents(events)
+	// Only the new events are logged, so replaying the record saves exactly the same ones
+	var newEvents []ScoreEvent
+	for i, event := range events {
+		if results[i] == SaveResultSaved {
+			newEvents = append(newEvents, event)
+		}
+	}
+
+	if len(newEvents) > 0 {
+		if _, err := s.wal.Append(walRecord{Type: walRecordScoreEvents, ScoreEvents: newEvents}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, event := range newEvents {
+		s.saveScoreEvent(event)
+	}
+	return results, nil
+}
+
+// ConsumeScoreEvents claims due events for the worker.
+// Leases aren't logged, a restart releases them, as the workers that held them are gone too.
+func (s *FileStorage) ConsumeScoreEvents(ctx context.Context, workerID string, limit int) ([]ScoreEvent, error) {
+	// Claims hold s.mu, so a lease checked before an outcome is logged can't be taken by another worker until it's applied
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.InMemStorage.ConsumeScoreEvents(ctx, workerID, limit)
+}
+
+// MarkScoreEventsAsProcessed logs and marks the given events leased to the worker as processed
+func (s *FileStorage) MarkScoreEventsAsProcessed(ctx context.Context, workerID string, events []ScoreEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	eventIDs, leaseErr := s.heldLeases(workerID, scoreEventIDs(events))
+	if len(eventIDs) == 0 {
+		return leaseErr
+	}
+
+	if _, err := s.wal.Append(walRecord{Type: walRecordProcessed, EventIDs: eventIDs}); err != nil {
+		return err
+	}
+
+	// The leases are already checked, and claims wait for s.mu, so they're still held
+	if err := s.markScoreEventsProcessed("", eventIDs); err != nil {
+		return err
+	}
+	return leaseErr
+}
+
+// MarkScoreEventFailed logs and records a failed processing attempt of an event leased to the worker
+func (s *FileStorage) MarkScoreEventFailed(ctx context.Context, workerID string, event ScoreEvent, reason error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.heldLeases(workerID, []string{event.EventID}); err != nil {
+		return err
+	}
+
+	// The outcome of the attempt is logged, so replaying it doesn't depend on the configured max attempts and backoff
+	failure := s.newScoreEventFailure(event.EventID, reason.Error())
+	rec := walRecord{Type: walRecordFailed, EventIDs: []string{event.EventID}, Error: failure.Reason}
+	if !failure.NextAttemptAt.IsZero() {
+		rec.NextAttemptAt = &failure.NextAttemptAt
+	}
+	if !failure.DeadLetteredAt.IsZero() {
+		rec.DeadLetter = true
+		rec.Time = &failure.DeadLetteredAt
+	}
+	if _, err := s.wal.Append(rec); err != nil {
+		return err
+	}
+
+	return s.failScoreEvent(failure)
+}
+
+// RequeueDeadLetters logs and requeues the given dead-lettered events
+func (s *FileStorage) RequeueDeadLetters(ctx context.Context, eventIDs []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logRequeueDeadLetters(s.findDeadLetters(eventIDs))
+}
+
+// RequeueAllDeadLetters logs and requeues every dead-lettered event
+func (s *FileStorage) RequeueAllDeadLetters(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The record has the IDs of the events rather than "all", as all is a different set of events on replay
+	return s.logRequeueDeadLetters(s.allDeadLetters())
+}
+
+// logRequeueDeadLetters logs and requeues the found dead letters, it must be called with s.mu held
+func (s *FileStorage) logRequeueDeadLetters(found []string) ([]string, error) {
+	if len(found) == 0 {
+		return nil, nil
+	}
+	if _, err := s.wal.Append(walRecord{Type: walRecordRequeue, EventIDs: found}); err != nil {
+		return nil, err
+	}
+
+	return s.requeueDeadLetters(found), nil
+}
+
+// PurgeDeadLetters logs and deletes the given dead-lettered events
+func (s *FileStorage) PurgeDeadLetters(ctx context.Context, eventIDs []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logPurgeDeadLetters(s.findDeadLetters(eventIDs))
+}
+
+// PurgeAllDeadLetters logs and deletes every dead-lettered event
+func (s *FileStorage) PurgeAllDeadLetters(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logPurgeDeadLetters(s.allDeadLetters())
+}
+
+// logPurgeDeadLetters logs and deletes the found dead letters, it must be called with s.mu held
+func (s *FileStorage) logPurgeDeadLetters(found []string) ([]string, error) {
+	if len(found) == 0 {
+		return nil, nil
+	}
+	if _, err := s.wal.Append(walRecord{Type: walRecordPurge, EventIDs: found}); err != nil {
+		return nil, err
+	}
+
+	return s.purgeDeadLetters(found), nil
+}
+
+// RetractScoreEvent logs and applies the retraction of the event
+func (s *FileStorage) RetractScoreEvent(ctx context.Context, eventID string, reason string) (EventCorrection, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	correction, found, err := s.newEventCorrection(eventID, nil, nil, reason)
+	if !found || err != nil {
+		return EventCorrection{}, found, err
+	}
+	if err := s.logEventCorrection(correction); err != nil {
+		return EventCorrection{}, true, err
+	}
+	return correction, true, nil
+}
+
+// CorrectScoreEvent logs and applies the correction of the event
+func (s *FileStorage) CorrectScoreEvent(ctx context.Context, event ScoreEvent, score TalentScore, reason string) (EventCorrection, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	correction, found, err := s.newEventCorrection(event.EventID, &event, &score, reason)
+	if !found || err != nil {
+		return EventCorrection{}, found, err
+	}
+	if err := s.logEventCorrection(correction); err != nil {
+		return EventCorrection{}, true, err
+	}
+	return correction, true, nil
+}
+
+// logEventCorrection must be called with mu held. The correction is logged as built,
+// so replaying it doesn't depend on the clock or on the scorer.
+func (s *FileStorage) logEventCorrection(correction EventCorrection) error {
+	if _, err := s.wal.Append(walRecord{Type: walRecordCorrection, Correction: &correction}); err != nil {
+		return err
+	}
+	s.applyEventCorrection(correction)
+	return nil
+}
+
+// SaveTalentScore logs and stores a talent score
+func (s *FileStorage) SaveTalentScore(ctx context.Context, talentScore TalentScore) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.wal.Append(walRecord{Type: walRecordTalentScore, TalentScore: &talentScore}); err != nil {
+		return err
+	}
+
+	return s.InMemStorage.SaveTalentScore(ctx, talentScore)
+}
+
+// CloseSeason logs and closes the current season
+func (s *FileStorage) CloseSeason(ctx context.Context) (Season, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at := s.now()
+	if _, err := s.wal.Append(walRecord{Type: walRecordCloseSeason, Time: &at, RankMode: s.rankMode}); err != nil {
+		return Season{}, err
+	}
+
+	return s.closeSeason(at, s.rankMode), nil
+}
+
+// RecordRanks records the ranks of all talents. The leaderboards are sorted before taking the lock,
+// and the resulting points are logged, so replaying the log doesn't depend on the writes made meanwhile.
+func (s *FileStorage) RecordRanks(ctx context.Context) error {
+	s.recordRanksMu.Lock()
+	defer s.recordRanksMu.Unlock()
+
+	at := s.now()
+	points := s.rankPoints(at)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.wal.Append(walRecord{Type: walRecordRankPoints, Time: &at, RankPoints: points}); err != nil {
+		return err
+	}
+
+	s.addRankPoints(at, points)
+	return nil
+}
+
+// Snapshot writes the current state to a new snapshot, then removes the log segments
+// and the snapshots that are no longer needed.
+func (s *FileStorage) Snapshot() (SnapshotInfo, error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	// The state and the LSN have to match, so no mutation may happen in between.
+	// Rolling the log here lets compaction remove every segment up to this point.
+	s.mu.Lock()
+	state := s.exportState()
+	lsn := s.wal.LastLSN()
+	err := s.wal.Roll()
+	s.mu.Unlock()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	return s.writeSnapshot(lsn, state)
+}
+
+// ListSnapshots returns all stored snapshots, oldest first
+func (s *FileStorage) ListSnapshots() ([]SnapshotInfo, error) {
+	return s.snapshots.list()
+}
+
+// VerifySnapshot checks that the snapshot is readable and its checksum matches
+func (s *FileStorage) VerifySnapshot(id uint64) (SnapshotInfo, error) {
+	_, info, err := s.snapshots.read(id)
+	return info, err
+}
+
+// RestoreSnapshot replaces the current state with the state of the given snapshot.
+// The restore is logged and followed by a new snapshot, so older and newer snapshots stay available.
+func (s *FileStorage) RestoreSnapshot(id uint64) (SnapshotInfo, error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	state, _, err := s.snapshots.read(id)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	s.mu.Lock()
+	lsn, err := s.wal.Append(walRecord{Type: walRecordRestore, SnapshotID: id})
+	if err != nil {
+		s.mu.Unlock()
+		return SnapshotInfo{}, err
+	}
+	s.importState(state)
+	err = s.wal.Roll()
+	s.mu.Unlock()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	return s.writeSnapshot(lsn, state)
+}
+
+// Close stops periodic snapshots, then flushes and closes the log. The storage must not be used afterwards.
+func (s *FileStorage) Close() error {
+	if s.stopSnapshots != nil {
+		close(s.stopSnapshots)
+		<-s.snapshotsDone
+	}
+	s.InMemStorage.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.wal.Close()
+	// The lock is released last, once nothing is written to the dir anymore
+	if lockErr := s.lock.Close(); err == nil {
+		err = lockErr
+	}
+	return err
+}
+
+// writeSnapshot must be called with snapshotMu held
+func (s *FileStorage) writeSnapshot(lsn uint64, state storageState) (SnapshotInfo, error) {
+	if s.snapshots.exists(lsn) {
+		// Nothing was logged since the last snapshot
+		_, info, err := s.snapshots.read(lsn)
+		return info, err
+	}
+
+	info, err := s.snapshots.write(lsn, state)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	if err := s.wal.RemoveSegmentsBefore(lsn); err != nil {
+		return info, fmt.Errorf("compact wal: %w", err)
+	}
+
+	snapshots, err := s.snapshots.list()
+	if err != nil {
+		return info, err
+	}
+	for len(snapshots) > s.opts.SnapshotRetain {
+		if err := s.snapshots.remove(snapshots[0].ID); err != nil {
+			return info, err
+		}
+		snapshots = snapshots[1:]
+	}
+
+	return info, nil
+}
+
+func (s *FileStorage) loadLatestSnapshot() error {
+	snapshots, err := s.snapshots.list()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	// The log before the latest snapshot is already compacted, so falling back to an older one would lose data.
+	latest := snapshots[len(snapshots)-1]
+	state, _, err := s.snapshots.read(latest.ID)
+	if err != nil {
+		return fmt.Errorf("load snapshot: %w", err)
+	}
+
+	s.importState(state)
+	s.appliedLSN = latest.ID
+	return nil
+}
+
+// startPeriodicSnapshot takes a snapshot every interval until the storage is closed
+func (s *FileStorage) startPeriodicSnapshot(interval time.Duration) {
+	defer close(s.snapshotsDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopSnapshots:
+			return
+		case <-ticker.C:
+			if _, err := s.Snapshot(); err != nil {
+				log.Printf("Error taking snapshot: %v", err)
+			}
+		}
+	}
+}
+
+// replay applies the log records written after the loaded snapshot
+func (s *FileStorage) replay(rec walRecord) error {
+	if rec.LSN <= s.appliedLSN {
+		return nil
+	}
+	if rec.LSN != s.appliedLSN+1 {
+		return fmt.Errorf("%w: log continues at lsn %d, but state is at lsn %d", ErrWALCorrupted, rec.LSN, s.appliedLSN)
+	}
+
+	if err := s.apply(rec); err != nil {
+		return err
+	}
+	s.appliedLSN = rec.LSN
+	return nil
+}
+
+// apply replays a single log record into memory
+func (s *FileStorage) apply(rec walRecord) error {
+	ctx := context.Background()
+
+	switch rec.Type {
+	case walRecordScoreEvent:
+		_, err := s.InMemStorage.SaveScoreEvent(ctx, *rec.ScoreEvent)
+		return err
+	case walRecordScoreEvents:
+		_, err := s.InMemStorage.SaveScoreEvents(ctx, rec.ScoreEvents)
+		return err
+	case walRecordProcessed:
+		return s.markScoreEventsProcessed("", rec.EventIDs)
+	case walRecordFailed:
+		for _, eventID := range rec.EventIDs {
+			failure := scoreEventFailure{EventID: eventID, Reason: rec.Error}
+			if rec.NextAttemptAt != nil {
+				failure.NextAttemptAt = *rec.NextAttemptAt
+			}
+			if rec.DeadLetter {
+				failure.DeadLetteredAt = *rec.Time
+			}
+			if err := s.failScoreEvent(failure); err != nil {
+				return err
+			}
+		}
+		return nil
+	case walRecordRequeue:
+		s.requeueDeadLetters(rec.EventIDs)
+		return nil
+	case walRecordPurge:
+		s.purgeDeadLetters(rec.EventIDs)
+		return nil
+	case walRecordTalentScore:
+		return s.InMemStorage.SaveTalentScore(ctx, *rec.TalentScore)
+	case walRecordCorrection:
+		s.applyEventCorrection(*rec.Correction)
+		return nil
+	case walRecordCloseSeason:
+		mode := rec.RankMode
+		if mode == "" {
+			// Logs written before the rank mode was recorded
+			mode = s.rankMode
+		}
+		s.closeSeason(*rec.Time, mode)
+		return nil
+	case walRecordRecordRanks:
+		s.recordRanks(*rec.Time)
+		return nil
+	case walRecordRankPoints:
+		s.addRankPoints(*rec.Time, rec.RankPoints)
+		return nil
+	case walRecordRestore:
+		state, _, err := s.snapshots.read(rec.SnapshotID)
+		if err != nil {
+			return err
+		}
+		s.importState(state)
+		return nil
+	}
+
+	return fmt.Errorf("unknown wal record type %q", rec.Type)
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_Recovery(t *testing.T) {
+	t.Run("state is rebuilt from the log after reopening", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+
+		storage, err := NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+
+		events := []ScoreEvent{
+			{EventID: "event-1", TalentID: "talent-1", Skill: SkillDribble, MetricValue: 50, Timestamp: time.Now().UTC()},
+			{EventID: "event-2", TalentID: "talent-2", Skill: SkillShoot, MetricValue: 80, Timestamp: time.Now().UTC()},
+		}
+		for _, event := range events {
+			saved, err := storage.SaveScoreEvent(ctx, event)
+			require.NoError(t, err)
+			require.True(t, saved)
+		}
+		claimed, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.Equal(t, events, claimed)
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillDribble, Score: 50, EventID: "event-1"}))
+		require.NoError(t, storage.MarkScoreEventsAsProcessed(ctx, "worker-1", events[:1]))
+		require.NoError(t, storage.MarkScoreEventFailed(ctx, "worker-1", events[1], errors.New("scorer unavailable")))
+		require.NoError(t, storage.Close())
+
+		storage, err = NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+		defer storage.Close()
+
+		saved, err := storage.SaveScoreEvent(ctx, events[0])
+		require.NoError(t, err)
+		assert.False(t, saved, "event IDs must survive a restart")
+
+		conflicting := events[0]
+		conflicting.MetricValue = 60
+		_, err = storage.SaveScoreEvent(ctx, conflicting)
+		assert.ErrorIs(t, err, ErrScoreEventConflict, "fingerprints must survive a restart")
+
+		pending, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		assert.Equal(t, events[1], pending[0])
+
+		status, found, err := storage.GetScoreEventStatus(ctx, "event-2")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, ScoreEventFailed, status.State)
+		assert.Equal(t, 1, status.Attempts)
+		assert.Equal(t, "scorer unavailable", status.LastError)
+
+		rank, found, err := storage.FindTalentRank(ctx, LeaderboardKey{}, "talent-1")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, 50, rank.TalentScore.Score)
+		assert.Equal(t, 1, rank.Rank)
+	})
+
+	t.Run("a batch logs exactly the events it saves", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+		opts := FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}}
+
+		storage, err := NewFileStorage(dir, opts)
+		require.NoError(t, err)
+		_, err = storage.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10})
+		require.NoError(t, err)
+
+		results, err := storage.SaveScoreEvents(ctx, []ScoreEvent{
+			{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10},
+			{EventID: "event-2", TalentID: "talent-2", Skill: SkillShoot, MetricValue: 20},
+			{EventID: "event-2", TalentID: "talent-2", Skill: SkillShoot, MetricValue: 20},
+			{EventID: "event-3", TalentID: "talent-3", Skill: SkillShoot, MetricValue: 30},
+			{EventID: "event-3", TalentID: "talent-3", Skill: SkillShoot, MetricValue: 40},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []SaveResult{SaveResultDuplicate, SaveResultSaved, SaveResultDuplicate, SaveResultSaved, SaveResultConflict}, results)
+		require.NoError(t, storage.Close())
+
+		storage, err = NewFileStorage(dir, opts)
+		require.NoError(t, err)
+		defer storage.Close()
+
+		pending, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 3)
+		assert.Equal(t, []string{"event-1", "event-2", "event-3"}, scoreEventIDs(pending))
+		assert.Equal(t, 30, pending[2].MetricValue)
+	})
+
+	t.Run("torn write at the end of the log is discarded", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+
+		storage, err := NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+		_, err = storage.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10})
+		require.NoError(t, err)
+		require.NoError(t, storage.Close())
+
+		segments, err := filepath.Glob(filepath.Join(dir, "wal", "*"+walSegmentExt))
+		require.NoError(t, err)
+		require.Len(t, segments, 1)
+		f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0o644)
+		require.NoError(t, err)
+		_, err = f.WriteString(`1234abcd {"lsn":2,"type":"score_ev`)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		storage, err = NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+
+		saved, err := storage.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-2", TalentID: "talent-1", Skill: SkillPass, MetricValue: 20})
+		require.NoError(t, err)
+		assert.True(t, saved)
+		require.NoError(t, storage.Close())
+
+		storage, err = NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+		defer storage.Close()
+
+		pending, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		assert.Len(t, pending, 2)
+	})
+
+	t.Run("leases are released by a restart", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+
+		storage, err := NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+		event := ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10}
+		_, err = storage.SaveScoreEvent(ctx, event)
+		require.NoError(t, err)
+		claimed, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		_, err = storage.Snapshot()
+		require.NoError(t, err)
+		require.NoError(t, storage.Close())
+
+		storage, err = NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+		defer storage.Close()
+
+		err = storage.MarkScoreEventsAsProcessed(ctx, "worker-1", claimed)
+		assert.ErrorIs(t, err, ErrLeaseNotHeld)
+		claimed, err = storage.ConsumeScoreEvents(ctx, "worker-2", 10)
+		require.NoError(t, err)
+		assert.Equal(t, []ScoreEvent{event}, claimed)
+	})
+}
+
+func TestFileStorage_Lock(t *testing.T) {
+	dir := t.TempDir()
+	opts := FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}}
+
+	storage, err := NewFileStorage(dir, opts)
+	require.NoError(t, err)
+
+	_, err = NewFileStorage(dir, opts)
+	assert.ErrorIs(t, err, ErrDataDirLocked, "a second storage must not write to the same log")
+
+	require.NoError(t, storage.Close())
+	storage, err = NewFileStorage(dir, opts)
+	require.NoError(t, err, "closing releases the lock")
+	require.NoError(t, storage.Close())
+}
+
+func TestFileStorage_Seasons(t *testing.T) {
+	t.Run("archived seasons survive a restart from the log and from a snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+		opts := FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}}
+
+		storage, err := NewFileStorage(dir, opts)
+		require.NoError(t, err)
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillPass, Score: 10, EventID: "event-1"}))
+		_, err = storage.CloseSeason(ctx)
+		require.NoError(t, err)
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillPass, Score: 20, EventID: "event-2"}))
+		require.NoError(t, storage.Close())
+
+		for _, takeSnapshot := range []bool{true, false} {
+			storage, err = NewFileStorage(dir, opts)
+			require.NoError(t, err)
+
+			archived, err := storage.GetTopRankedTalents(ctx, LeaderboardKey{Season: 1}, 10)
+			require.NoError(t, err)
+			require.Len(t, archived, 1)
+			assert.Equal(t, TalentID("talent-1"), archived[0].TalentID)
+
+			current, err := storage.GetTopRankedTalents(ctx, LeaderboardKey{}, 10)
+			require.NoError(t, err)
+			require.Len(t, current, 1)
+			assert.Equal(t, TalentID("talent-2"), current[0].TalentID)
+
+			if takeSnapshot {
+				_, err = storage.Snapshot()
+				require.NoError(t, err)
+			}
+			require.NoError(t, storage.Close())
+		}
+	})
+
+	t.Run("archived standings keep their ranks after the rank mode changes", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+
+		storage, err := NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour, RankMode: RankModeOrdinal}})
+		require.NoError(t, err)
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillPass, Score: 20, EventID: "event-1"}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillPass, Score: 10, EventID: "event-2"}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-3", Skill: SkillPass, Score: 10, EventID: "event-3"}))
+		_, err = storage.CloseSeason(ctx)
+		require.NoError(t, err)
+		require.NoError(t, storage.Close())
+
+		opts := FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour, RankMode: RankModeDense}}
+		for _, takeSnapshot := range []bool{true, false} {
+			storage, err = NewFileStorage(dir, opts)
+			require.NoError(t, err)
+
+			archived, err := storage.GetTopRankedTalents(ctx, LeaderboardKey{Season: 1}, 10)
+			require.NoError(t, err)
+			require.Len(t, archived, 3)
+			assert.Equal(t, []int{1, 2, 3}, []int{archived[0].Rank, archived[1].Rank, archived[2].Rank})
+
+			if takeSnapshot {
+				_, err = storage.Snapshot()
+				require.NoError(t, err)
+			}
+			require.NoError(t, storage.Close())
+		}
+	})
+}
+
+func TestFileStorage_RankHistory(t *testing.T) {
+	t.Run("rank history survives a restart from the log and from a snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+		opts := FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}}
+
+		storage, err := NewFileStorage(dir, opts)
+		require.NoError(t, err)
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillPass, Score: 10, EventID: "event-1"}))
+		require.NoError(t, storage.RecordRanks(ctx))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillPass, Score: 20, EventID: "event-2"}))
+		require.NoError(t, storage.RecordRanks(ctx))
+		require.NoError(t, storage.Close())
+
+		for _, takeSnapshot := range []bool{true, false} {
+			storage, err = NewFileStorage(dir, opts)
+			require.NoError(t, err)
+
+			points, err := storage.GetRankHistory(ctx, SkillPass, "talent-1", time.Time{}, time.Time{})
+			require.NoError(t, err)
+			require.Len(t, points, 2)
+			assert.Equal(t, 1, points[0].Rank)
+			assert.Equal(t, 2, points[1].Rank)
+
+			if takeSnapshot {
+				_, err = storage.Snapshot()
+				require.NoError(t, err)
+			}
+			require.NoError(t, storage.Close())
+		}
+	})
+
+	t.Run("events are saved while the ranks are sorted", func(t *testing.T) {
+		ctx := context.Background()
+		storage, err := NewFileStorage(t.TempDir(), FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+		defer storage.Close()
+
+		// The scores don't need to survive a restart here, so they skip the log to fill a large board quickly
+		for i := range 50000 {
+			talentScore := TalentScore{TalentID: TalentID(fmt.Sprintf("talent-%d", i)), Skill: SkillPass, Score: i % 1000, EventID: fmt.Sprintf("event-%d", i)}
+			require.NoError(t, storage.InMemStorage.SaveTalentScore(ctx, talentScore))
+		}
+
+		recorded := make(chan error, 1)
+		go func() {
+			recorded <- storage.RecordRanks(ctx)
+		}()
+		// Wait until the recording has started sorting
+		for storage.recordRanksMu.TryLock() {
+			storage.recordRanksMu.Unlock()
+			runtime.Gosched()
+		}
+
+		saved, err := storage.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-new", TalentID: "talent-new", Skill: SkillPass, MetricValue: 1, Timestamp: time.Now()})
+		require.NoError(t, err)
+		assert.True(t, saved)
+		select {
+		case <-recorded:
+			t.Fatal("the event was only saved after the ranks were recorded")
+		default:
+		}
+		require.NoError(t, <-recorded)
+	})
+}
+
+func TestFileStorage_Corrections(t *testing.T) {
+	t.Run("corrections survive a restart from the log and from a snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+		opts := FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}}
+
+		storage, err := NewFileStorage(dir, opts)
+		require.NoError(t, err)
+		events := []ScoreEvent{
+			{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10},
+			{EventID: "event-2", TalentID: "talent-2", Skill: SkillPass, MetricValue: 20},
+		}
+		for _, event := range events {
+			_, err = storage.SaveScoreEvent(ctx, event)
+			require.NoError(t, err)
+			require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: event.TalentID, Skill: event.Skill, Score: event.MetricValue, EventID: event.EventID}))
+		}
+		_, err = storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.NoError(t, storage.MarkScoreEventsAsProcessed(ctx, "worker-1", events))
+
+		_, _, err = storage.RetractScoreEvent(ctx, "event-1", "duplicate drill")
+		require.NoError(t, err)
+		corrected := events[1]
+		corrected.MetricValue = 30
+		_, _, err = storage.CorrectScoreEvent(ctx, corrected, TalentScore{TalentID: "talent-2", Skill: SkillPass, Score: 30, EventID: "event-2"}, "typo")
+		require.NoError(t, err)
+		require.NoError(t, storage.Close())
+
+		for _, takeSnapshot := range []bool{true, false} {
+			storage, err = NewFileStorage(dir, opts)
+			require.NoError(t, err)
+
+			status, _, err := storage.GetScoreEventStatus(ctx, "event-1")
+			require.NoError(t, err)
+			assert.Equal(t, ScoreEventRetracted, status.State)
+			require.Len(t, status.Corrections, 1)
+			assert.Equal(t, "duplicate drill", status.Corrections[0].Reason)
+			_, found, err := storage.FindTalentRank(ctx, LeaderboardKey{Skill: SkillPass}, "talent-1")
+			require.NoError(t, err)
+			assert.False(t, found)
+
+			status, _, err = storage.GetScoreEventStatus(ctx, "event-2")
+			require.NoError(t, err)
+			assert.Equal(t, corrected, status.Event)
+			require.NotNil(t, status.TalentScore)
+			assert.Equal(t, 30, status.TalentScore.Score)
+
+			saved, err := storage.SaveScoreEvent(ctx, events[1])
+			require.NoError(t, err)
+			assert.False(t, saved, "the fingerprint of the event as it was received must survive a restart")
+
+			if takeSnapshot {
+				_, err = storage.Snapshot()
+				require.NoError(t, err)
+			}
+			require.NoError(t, storage.Close())
+		}
+	})
+}
+
+func TestFileStorage_DeadLetters(t *testing.T) {
+	t.Run("dead letters survive a restart with a different max attempts", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+
+		storage, err := NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour, MaxAttempts: 1}})
+		require.NoError(t, err)
+		events := []ScoreEvent{
+			{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10},
+			{EventID: "event-2", TalentID: "talent-2", Skill: SkillPass, MetricValue: 20},
+			{EventID: "event-3", TalentID: "talent-3", Skill: SkillPass, MetricValue: 30},
+		}
+		for _, event := range events {
+			_, err = storage.SaveScoreEvent(ctx, event)
+			require.NoError(t, err)
+			_, err = storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+			require.NoError(t, err)
+			require.NoError(t, storage.MarkScoreEventFailed(ctx, "worker-1", event, errors.New("scorer rejected the metric")))
+		}
+		requeued, err := storage.RequeueDeadLetters(ctx, []string{"event-1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"event-1"}, requeued)
+		purged, err := storage.PurgeDeadLetters(ctx, []string{"event-2"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"event-2"}, purged)
+		require.NoError(t, storage.Close())
+
+		for _, takeSnapshot := range []bool{true, false} {
+			storage, err = NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour, MaxAttempts: 10}})
+			require.NoError(t, err)
+
+			deadLetters, total, err := storage.ListDeadLetters(ctx, 0, 10)
+			require.NoError(t, err)
+			assert.Equal(t, 1, total)
+			require.Len(t, deadLetters, 1)
+			assert.Equal(t, "event-3", deadLetters[0].Event.EventID)
+			assert.Equal(t, "scorer rejected the metric", deadLetters[0].LastError)
+
+			pending, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+			require.NoError(t, err)
+			assert.Equal(t, events[:1], pending)
+
+			_, found, err := storage.GetScoreEventStatus(ctx, "event-2")
+			require.NoError(t, err)
+			assert.False(t, found)
+
+			// The purged event's ID is still taken, with the payload it was saved with
+			saved, err := storage.SaveScoreEvent(ctx, events[1])
+			require.NoError(t, err)
+			assert.False(t, saved)
+			reused := events[1]
+			reused.MetricValue = 25
+			_, err = storage.SaveScoreEvent(ctx, reused)
+			assert.ErrorIs(t, err, ErrScoreEventConflict)
+
+			if takeSnapshot {
+				_, err = storage.Snapshot()
+				require.NoError(t, err)
+			}
+			require.NoError(t, storage.Close())
+		}
+	})
+
+	t.Run("next attempt survives a restart with a different retry policy", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		clock := func() time.Time { return now }
+
+		storage, err := NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{
+			RefreshInterval: time.Hour,
+			Retry:           RetryPolicy{BaseDelay: time.Minute, Jitter: 0.5},
+			Now:             clock,
+		}})
+		require.NoError(t, err)
+		event := ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10}
+		_, err = storage.SaveScoreEvent(ctx, event)
+		require.NoError(t, err)
+		_, err = storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.NoError(t, storage.MarkScoreEventFailed(ctx, "worker-1", event, errors.New("scorer timed out")))
+		status, _, err := storage.GetScoreEventStatus(ctx, event.EventID)
+		require.NoError(t, err)
+		nextAttemptAt := status.NextAttemptAt
+		require.True(t, nextAttemptAt.After(now))
+		require.NoError(t, storage.Close())
+
+		for _, takeSnapshot := range []bool{true, false} {
+			storage, err = NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour, Now: clock}})
+			require.NoError(t, err)
+
+			status, _, err := storage.GetScoreEventStatus(ctx, event.EventID)
+			require.NoError(t, err)
+			assert.True(t, nextAttemptAt.Equal(status.NextAttemptAt))
+			pending, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+			require.NoError(t, err)
+			assert.Empty(t, pending)
+
+			if takeSnapshot {
+				_, err = storage.Snapshot()
+				require.NoError(t, err)
+			}
+			require.NoError(t, storage.Close())
+		}
+	})
+}
+
+func TestFileStorage_Snapshot(t *testing.T) {
+	t.Run("recovers from snapshot and the log after it", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+
+		storage, err := NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+
+		_, err = storage.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10})
+		require.NoError(t, err)
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillPass, Score: 10, EventID: "event-1"}))
+		_, err = storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.NoError(t, storage.MarkScoreEventsAsProcessed(ctx, "worker-1", []ScoreEvent{{EventID: "event-1"}}))
+
+		snapshot, err := storage.Snapshot()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), snapshot.ID)
+
+		segments, err := filepath.Glob(filepath.Join(dir, "wal", "*"+walSegmentExt))
+		require.NoError(t, err)
+		assert.Len(t, segments, 1, "segments covered by the snapshot must be removed")
+
+		_, err = storage.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-2", TalentID: "talent-2", Skill: SkillPass, MetricValue: 20})
+		require.NoError(t, err)
+		require.NoError(t, storage.Close())
+
+		storage, err = NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+		defer storage.Close()
+
+		saved, err := storage.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10})
+		require.NoError(t, err)
+		assert.False(t, saved)
+
+		_, err = storage.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 99})
+		assert.ErrorIs(t, err, ErrScoreEventConflict, "fingerprints must be restored from the snapshot")
+
+		pending, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		assert.Equal(t, "event-2", pending[0].EventID)
+
+		_, found, err := storage.FindTalentRank(ctx, LeaderboardKey{}, "talent-1")
+		require.NoError(t, err)
+		assert.True(t, found)
+	})
+
+	t.Run("restore brings back an older snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		ctx := context.Background()
+
+		storage, err := NewFileStorage(dir, FileStorageOptions{InMem: InMemStorageOptions{RefreshInterval: time.Hour}})
+		require.NoError(t, err)
+		defer storage.Close()
+
+		_, err = storage.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10})
+		require.NoError(t, err)
+		first, err := storage.Snapshot()
+		require.NoError(t, err)
+
+		_, err = storage.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-2", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10})
+		require.NoError(t, err)
+		_, err = storage.Snapshot()
+		require.NoError(t, err)
+
+		_, err = storage.VerifySnapshot(first.ID)
+		require.NoError(t, err)
+		restored, err := storage.RestoreSnapshot(first.ID)
+		require.NoError(t, err)
+
+		snapshots, err := storage.ListSnapshots()
+		require.NoError(t, err)
+		require.Len(t, snapshots, 3)
+		assert.Equal(t, restored.ID, snapshots[2].ID)
+
+		pending, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		assert.Equal(t, "event-1", pending[0].EventID)
+	})
+}
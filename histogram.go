@@ -0,0 +1,48 @@
+package main
+
+import "math/bits"
+
+// histogramSubBuckets is the number of buckets per power of two. Scores below it get a bucket each,
+// higher scores share buckets whose width grows with the score, so the relative error stays under 1/64.
+const histogramSubBuckets = 64
+
+// scoreHistogram counts talents per score bucket. It answers how many talents have a better score
+// than a given one in O(buckets), and takes a few KB no matter how many talents there are.
+// It's not safe for concurrent use.
+type scoreHistogram struct {
+	counts []int
+	total  int
+}
+
+// histogramBucket maps a score to its bucket, preserving the order of scores
+func histogramBucket(score int) int {
+	if score < histogramSubBuckets {
+		return max(score, 0)
+	}
+	// Keep the 7 most significant bits of the score, the top one being the power of two
+	shift := bits.Len(uint(score)) - 7
+	return histogramSubBuckets*(shift+1) + (score >> shift) - histogramSubBuckets
+}
+
+// Add changes the number of talents with the score by delta
+func (h *scoreHistogram) Add(score, delta int) {
+	bucket := histogramBucket(score)
+	if bucket >= len(h.counts) {
+		h.counts = append(h.counts, make([]int, bucket+1-len(h.counts))...)
+	}
+	h.counts[bucket] += delta
+	h.total += delta
+}
+
+// Above returns the number of talents in higher buckets than the score
+func (h *scoreHistogram) Above(score int) int {
+	above := 0
+	for bucket := histogramBucket(score) + 1; bucket < len(h.counts); bucket++ {
+		above += h.counts[bucket]
+	}
+	return above
+}
+
+func (h *scoreHistogram) Total() int {
+	return h.total
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScoreHistogram(t *testing.T) {
+	t.Run("buckets keep the order of scores", func(t *testing.T) {
+		previous := histogramBucket(0)
+		for score := 1; score < 1<<20; score++ {
+			bucket := histogramBucket(score)
+			if bucket < previous {
+				t.Fatalf("score %d is in bucket %d, before the bucket %d of a lower score", score, bucket, previous)
+			}
+			previous = bucket
+		}
+		assert.Less(t, histogramBucket(1<<20), 64*16)
+	})
+
+	t.Run("counts talents above a score", func(t *testing.T) {
+		h := &scoreHistogram{}
+		for score := 1; score <= 100; score++ {
+			h.Add(score, 1)
+		}
+		h.Add(50, 1)
+		h.Add(100, -1)
+
+		assert.Equal(t, 100, h.Total())
+		assert.Equal(t, 49, h.Above(50))
+		assert.Equal(t, 0, h.Above(99))
+		assert.Equal(t, 100, h.Above(0))
+	})
+}
@@ -1,10 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,10 +25,127 @@ type CreateEventRequest struct {
 	Timestamp time.Time `json:"ts"`
 }
 
+const (
+	// maxBatchSize is the maximum number of events in a POST /events:batch request
+	maxBatchSize = 1000
+	// maxBatchBytes is the maximum body size of POST /events:batch
+	maxBatchBytes = 4 << 20
+	// streamChunkSize is the maximum number of lines of POST /events/stream saved at once
+	streamChunkSize = 100
+	// maxStreamLineBytes is the maximum length of a line of POST /events/stream
+	maxStreamLineBytes = 1 << 20
+	// maxEventBytes is the maximum body size of POST /events
+	maxEventBytes = 1 << 20
+)
+
+type BatchEventStatus string
+
+const (
+	BatchEventAccepted  BatchEventStatus = "accepted"
+	BatchEventDuplicate BatchEventStatus = "duplicate"
+	// BatchEventConflict is an event that reuses the ID of a different event
+	BatchEventConflict BatchEventStatus = "conflict"
+	BatchEventInvalid  BatchEventStatus = "invalid"
+)
+
+type BatchEventsResponse struct {
+	// Results has the outcome of each event, in the order of the request
+	Results    []BatchEventResult `json:"results"`
+	Accepted   int                `json:"accepted"`
+	Duplicates int                `json:"duplicates"`
+	Conflicts  int                `json:"conflicts"`
+	Invalid    int                `json:"invalid"`
+}
+
+type BatchEventResult struct {
+	// Index is the 0-based position of the event in the batch, or in the stream without the blank lines
+	Index   int              `json:"index"`
+	EventID string           `json:"event_id,omitempty"`
+	Status  BatchEventStatus `json:"status"`
+	// Reason is why an invalid event was rejected
+	Reason     string           `json:"reason,omitempty"`
+	Violations []FieldViolation `json:"violations,omitempty"`
+}
+
+type ScoreEventStatusResponse struct {
+	Event    CreateEventRequest `json:"event"`
+	Status   string             `json:"status"`
+	Attempts int                `json:"attempts"`
+	// LastError is the error of the last failed processing attempt
+	LastError string `json:"last_error,omitempty"`
+	// NextAttemptAt is set while a failed event waits for its next attempt
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	// LeasedBy is the worker that claimed the event and hasn't reported its outcome yet,
+	// and LeaseExpiresAt is when other workers can claim it
+	LeasedBy       string     `json:"leased_by,omitempty"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	// DeadLetteredAt is set while the event is dead-lettered
+	DeadLetteredAt *time.Time `json:"dead_lettered_at,omitempty"`
+	// TalentScore is the score calculated from the event, only set once it's processed
+	TalentScore *EventTalentScoreResponse `json:"talent_score,omitempty"`
+	// Corrections is the audit trail of the admin changes to the event, oldest first
+	Corrections []EventCorrectionResponse `json:"corrections,omitempty"`
+}
+
+type DeadLettersResponse struct {
+	Events []ScoreEventStatusResponse `json:"events"`
+	// Total is the number of dead-lettered events
+	Total int `json:"total"`
+}
+
+// DeadLettersRequest is the body of POST /dead-letters/requeue and DELETE /dead-letters.
+// It names the events in EventIDs, or sets All for every dead-lettered event.
+type DeadLettersRequest struct {
+	EventIDs []string `json:"event_ids"`
+	// All applies the action to every dead-lettered event. It must be set explicitly, so a missing or empty
+	// list of events doesn't apply to all of them.
+	All bool `json:"all"`
+}
+
+// DeadLettersActionResponse lists the events a requeue or purge applied to
+type DeadLettersActionResponse struct {
+	EventIDs []string `json:"event_ids"`
+	Count    int      `json:"count"`
+}
+
+// CorrectEventRequest is the body of PATCH /events/{event_id}. Only the given fields are changed.
+type CorrectEventRequest struct {
+	TalentID  *string    `json:"talent_id"`
+	RawMetric *int       `json:"raw_metric"`
+	Skill     *string    `json:"skill"`
+	Timestamp *time.Time `json:"ts"`
+	// Reason is kept in the audit trail
+	Reason string `json:"reason"`
+}
+
+type EventCorrectionResponse struct {
+	Action    string              `json:"action"`
+	Reason    string              `json:"reason,omitempty"`
+	At        time.Time           `json:"at"`
+	Previous  CreateEventRequest  `json:"previous"`
+	Corrected *CreateEventRequest `json:"corrected,omitempty"`
+	// PreviousScore is the removed score, omitted if the event wasn't scored yet
+	PreviousScore *EventTalentScoreResponse `json:"previous_score,omitempty"`
+	Score         *EventTalentScoreResponse `json:"score,omitempty"`
+}
+
+type EventTalentScoreResponse struct {
+	Score  int `json:"score"`
+	Season int `json:"season"`
+}
+
 type LeaderboardResponse struct {
 	Talents []TalentRankResponse `json:"talents"`
 }
 
+type LeaderboardPageResponse struct {
+	Talents []TalentRankResponse `json:"talents"`
+	// Total is the number of talents in the leaderboard
+	Total int `json:"total"`
+	// NextCursor is passed as the cursor parameter to read the next page. Omitted on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
 type TalentRankResponse struct {
 	Rank     int    `json:"rank"`
 	TalentID string `json:"talent_id"`
@@ -27,23 +153,97 @@ type TalentRankResponse struct {
 }
 
 type GetTalentRankResponse struct {
+	// Rank may be estimated for talents ranked below HTTPOptions.ExactRankLimit, which have a RankBucket
 	Rank     int    `json:"rank"`
 	TalentID string `json:"talent_id"`
 	Score    int    `json:"score"`
+	// Percentile is the percentage of talents ranked at or above the talent, e.g. 3 for the top 3%
+	Percentile float64 `json:"percentile"`
+	// RankBucket is the rank range of talents ranked below HTTPOptions.ExactRankLimit, e.g. "10000+"
+	RankBucket string `json:"rank_bucket,omitempty"`
+	// PreviousRank is the rank when ranks were last recorded, omitted if the talent has no rank history
+	PreviousRank int `json:"previous_rank,omitempty"`
+	// Delta is the number of places the talent moved up since PreviousRank, negative if it moved down
+	Delta *int `json:"delta,omitempty"`
+}
+
+type TalentProfileResponse struct {
+	TalentID        string     `json:"talent_id"`
+	ScoreCount      int        `json:"score_count"`
+	FirstActivityAt *time.Time `json:"first_activity_at,omitempty"`
+	LastActivityAt  *time.Time `json:"last_activity_at,omitempty"`
+	// Rank is the rank in the global leaderboard of the current season, omitted if the talent isn't ranked
+	Rank  int                 `json:"rank,omitempty"`
+	Bests []SkillBestResponse `json:"bests"`
+}
+
+type SkillBestResponse struct {
+	Skill     string    `json:"skill"`
+	Score     int       `json:"score"`
+	EventID   string    `json:"event_id"`
+	Timestamp time.Time `json:"ts"`
+}
+
+type RankHistoryResponse struct {
+	TalentID string                     `json:"talent_id"`
+	Skill    string                     `json:"skill,omitempty"`
+	Points   []RankHistoryPointResponse `json:"points"`
+}
+
+type RankHistoryPointResponse struct {
+	At     time.Time `json:"at"`
+	Season int       `json:"season"`
+	Rank   int       `json:"rank"`
+	Score  int       `json:"score"`
+}
+
+type SeasonResponse struct {
+	ID        int        `json:"id"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+type SeasonsResponse struct {
+	Seasons []SeasonResponse `json:"seasons"`
 }
 
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
+	// Violations lists every rule an invalid event breaks
+	Violations []FieldViolation `json:"violations,omitempty"`
 }
 
 type HTTPHandler struct {
-	service *Service
+	service   *Service
+	opts      HTTPOptions
+	validator *EventValidator
 }
 
-func NewHTTPHandler(service *Service) *HTTPHandler {
+type HTTPOptions struct {
+	// Location is the timezone dates in query parameters are read in (default is UTC)
+	Location *time.Location
+	// AdminToken protects the admin endpoints, which then require an "Authorization: Bearer <token>" header.
+	// If it's empty, admin endpoints are disabled, unless AdminOpen is set.
+	AdminToken string
+	// AdminOpen opens the admin endpoints to everyone when there's no AdminToken
+	AdminOpen bool
+	// ExactRankLimit is the rank up to which /rank returns exact ranks. Talents below it get a rank bucket,
+	// and their rank may be estimated. Zero means ranks are always exact.
+	ExactRankLimit int
+	// Validation is the rules incoming events are checked against
+	Validation ValidationRules
+}
+
+func NewHTTPHandler(service *Service, opts HTTPOptions) *HTTPHandler {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+
 	return &HTTPHandler{
-		service: service,
+		service:   service,
+		opts:      opts,
+		validator: NewEventValidator(opts.Validation),
 	}
 }
 
@@ -51,8 +251,28 @@ func (h *HTTPHandler) SetupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("POST /events", h.CreateEventHandler)
+	mux.HandleFunc("POST /events:batch", h.CreateEventsBatchHandler)
+	mux.HandleFunc("POST /events/stream", h.CreateEventsStreamHandler)
+	mux.HandleFunc("GET /events/{event_id}", h.GetEventStatusHandler)
+	mux.HandleFunc("DELETE /events/{event_id}", h.adminOnly(h.RetractEventHandler))
+	mux.HandleFunc("PATCH /events/{event_id}", h.adminOnly(h.CorrectEventHandler))
+	mux.HandleFunc("GET /dead-letters", h.adminOnly(h.ListDeadLettersHandler))
+	mux.HandleFunc("GET /dead-letters/{event_id}", h.adminOnly(h.GetDeadLetterHandler))
+	mux.HandleFunc("POST /dead-letters/requeue", h.adminOnly(h.RequeueDeadLettersHandler))
+	mux.HandleFunc("POST /dead-letters/{event_id}/requeue", h.adminOnly(h.RequeueDeadLettersHandler))
+	mux.HandleFunc("DELETE /dead-letters", h.adminOnly(h.PurgeDeadLettersHandler))
+	mux.HandleFunc("DELETE /dead-letters/{event_id}", h.adminOnly(h.PurgeDeadLettersHandler))
 	mux.HandleFunc("GET /leaderboard", h.GetLeaderboardHandler)
 	mux.HandleFunc("GET /rank/{talent_id}", h.GetTalentRankHandler)
+	mux.HandleFunc("GET /rank/{talent_id}/neighbors", h.GetTalentNeighborsHandler)
+
+	mux.HandleFunc("GET /talents/{talent_id}", h.GetTalentProfileHandler)
+	mux.HandleFunc("GET /talents/{talent_id}/rank-history", h.GetRankHistoryHandler)
+	mux.HandleFunc("GET /seasons", h.GetSeasonsHandler)
+	mux.HandleFunc("POST /seasons/close", h.adminOnly(h.CloseSeasonHandler))
+	mux.HandleFunc("GET /seasons/{season_id}/leaderboard", h.GetLeaderboardHandler)
+	mux.HandleFunc("GET /seasons/{season_id}/rank/{talent_id}", h.GetTalentRankHandler)
+	mux.HandleFunc("GET /seasons/{season_id}/rank/{talent_id}/neighbors", h.GetTalentNeighborsHandler)
 
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -63,27 +283,32 @@ func (h *HTTPHandler) SetupRoutes() http.Handler {
 }
 
 func (h *HTTPHandler) CreateEventHandler(w http.ResponseWriter, r *http.Request) {
-	var req CreateEventRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON", err.Error())
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEventBytes))
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid body", err.Error())
 		return
 	}
 
-	skill := Skill(req.Skill)
-	if skill != SkillDribble && skill != SkillShoot && skill != SkillPass {
-		writeErrorResponse(w, http.StatusBadRequest, "Invalid skill", "skill must be one of: dribble, shoot, pass")
+	event, err := h.validator.Parse(body)
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		writeJSONResponse(w, http.StatusUnprocessableEntity, ErrorResponse{
+			Error:      "Invalid event",
+			Message:    validationErr.Error(),
+			Violations: validationErr.Violations,
+		})
 		return
 	}
-
-	event := ScoreEvent{
-		EventID:     req.EventID,
-		TalentID:    TalentID(req.TalentID),
-		Skill:       skill,
-		MetricValue: req.RawMetric,
-		Timestamp:   req.Timestamp,
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
 	}
 
 	saved, err := h.service.SaveScoreEvent(r.Context(), event)
+	if err == ErrScoreEventConflict {
+		writeErrorResponse(w, http.StatusConflict, "Event ID conflict", fmt.Sprintf("Event ID '%s' is already used by an event with a different payload", event.EventID))
+		return
+	}
 	if err != nil {
 		writeErrorResponse(w, http.StatusInternalServerError, "Failed to save event", err.Error())
 		return
@@ -98,6 +323,508 @@ func (h *HTTPHandler) CreateEventHandler(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 }
 
+// CreateEventsBatchHandler saves a JSON array of events at once. Every event is validated on its own,
+// and the response has the outcome of each, so a single invalid event doesn't reject the whole batch.
+func (h *HTTPHandler) CreateEventsBatchHandler(w http.ResponseWriter, r *http.Request) {
+	items, err := decodeBatchItems(http.MaxBytesReader(w, r.Body, maxBatchBytes))
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, errBatchTooLarge) {
+		writeErrorResponse(w, http.StatusRequestEntityTooLarge, "Batch too large", fmt.Sprintf("a batch can have at most %d events", maxBatchSize))
+		return
+	}
+	if errors.As(err, &maxBytesErr) {
+		writeErrorResponse(w, http.StatusRequestEntityTooLarge, "Batch too large", fmt.Sprintf("a batch can be at most %d bytes", maxBatchBytes))
+		return
+	}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON", "body must be a JSON array of events: "+err.Error())
+		return
+	}
+
+	results, err := h.saveEventItems(r.Context(), items, 0)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to save events", err.Error())
+		return
+	}
+
+	response := BatchEventsResponse{Results: results}
+	for _, result := range response.Results {
+		switch result.Status {
+		case BatchEventAccepted:
+			response.Accepted++
+		case BatchEventDuplicate:
+			response.Duplicates++
+		case BatchEventConflict:
+			response.Conflicts++
+		case BatchEventInvalid:
+			response.Invalid++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+var errBatchTooLarge = errors.New("batch has too many events")
+
+// decodeBatchItems reads the items of a JSON array one by one, and stops with errBatchTooLarge
+// as soon as there are more than maxBatchSize, without reading the rest of the array.
+func decodeBatchItems(body io.Reader) ([]json.RawMessage, error) {
+	dec := json.NewDecoder(body)
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("not an array")
+	}
+
+	var items []json.RawMessage
+	for dec.More() {
+		if len(items) == maxBatchSize {
+			return nil, errBatchTooLarge
+		}
+		var item json.RawMessage
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	// The closing bracket
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// CreateEventsStreamHandler ingests an unbounded application/x-ndjson stream of events, one event per line.
+// Events are saved in chunks as they arrive, and the result of each line is streamed back as soon as its chunk is saved.
+// Lines are only read as fast as they're saved, so a client sending faster than that is slowed down by TCP flow control.
+func (h *HTTPHandler) CreateEventsStreamHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-ndjson" {
+		writeErrorResponse(w, http.StatusUnsupportedMediaType, "Unsupported content type", "Content-Type must be application/x-ndjson")
+		return
+	}
+
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+	// HTTP/1 doesn't allow writing the response before the request is read, unless it's enabled.
+	// HTTP/2 always allows it, and returns an error here.
+	_ = rc.EnableFullDuplex()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	// lines is bounded, so reading stops while the saving is behind
+	lines := make(chan json.RawMessage, streamChunkSize)
+	readErr := make(chan error, 1)
+	// done stops the reader when the handler returns early, and stopped is closed once the reader has returned,
+	// so the body isn't read after the handler is done with the request
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(done)
+		select {
+		case <-stopped:
+		default:
+			// The reader may be waiting for the client, a past read deadline makes that read return.
+			// Without deadlines nothing can interrupt the read, so the reader is left to end with the request.
+			if err := rc.SetReadDeadline(time.Now()); err == nil {
+				<-stopped
+			}
+		}
+	}()
+	go func() {
+		defer close(stopped)
+		defer close(lines)
+
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineBytes)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			select {
+			case lines <- json.RawMessage(bytes.Clone(line)):
+			case <-done:
+				return
+			case <-ctx.Done():
+				readErr <- ctx.Err()
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	encoder := json.NewEncoder(w)
+	index := 0
+	for item := range lines {
+		// Take the lines that are already read without waiting for more, so a slow client gets its results right away
+		chunk := []json.RawMessage{item}
+	drain:
+		for len(chunk) < streamChunkSize {
+			select {
+			case item, ok := <-lines:
+				if !ok {
+					break drain
+				}
+				chunk = append(chunk, item)
+			default:
+				break drain
+			}
+		}
+
+		results, err := h.saveEventItems(ctx, chunk, index)
+		if err != nil {
+			encoder.Encode(ErrorResponse{Error: "Failed to save events", Message: err.Error()})
+			return
+		}
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		index += len(chunk)
+	}
+
+	if err := <-readErr; err != nil {
+		encoder.Encode(ErrorResponse{Error: "Failed to read stream", Message: err.Error()})
+	}
+}
+
+// saveEventItems validates each item on its own and saves the valid ones with a single storage call.
+// Results are in the order of items, and their index starts from firstIndex.
+func (h *HTTPHandler) saveEventItems(ctx context.Context, items []json.RawMessage, firstIndex int) ([]BatchEventResult, error) {
+	results := make([]BatchEventResult, len(items))
+	var events []ScoreEvent
+	// positions is the index in items of each event in events
+	var positions []int
+	for i, item := range items {
+		results[i].Index = firstIndex + i
+
+		event, err := h.validator.Parse(item)
+		results[i].EventID = event.EventID
+		if err != nil {
+			results[i].Status = BatchEventInvalid
+			results[i].Reason = err.Error()
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				results[i].Violations = validationErr.Violations
+			}
+			continue
+		}
+		events = append(events, event)
+		positions = append(positions, i)
+	}
+
+	if len(events) == 0 {
+		return results, nil
+	}
+
+	saved, err := h.service.SaveScoreEvents(ctx, events)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range positions {
+		switch saved[j] {
+		case SaveResultSaved:
+			results[i].Status = BatchEventAccepted
+		case SaveResultDuplicate:
+			results[i].Status = BatchEventDuplicate
+		case SaveResultConflict:
+			results[i].Status = BatchEventConflict
+			results[i].Reason = ErrScoreEventConflict.Error()
+		}
+	}
+	return results, nil
+}
+
+// GetEventStatusHandler responds with the stored score event and where it is in its processing
+func (h *HTTPHandler) GetEventStatusHandler(w http.ResponseWriter, r *http.Request) {
+	eventID := r.PathValue("event_id")
+
+	status, err := h.service.GetScoreEventStatus(r.Context(), eventID)
+	if err != nil {
+		if err == ErrScoreEventNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Event not found", fmt.Sprintf("Event with ID '%s' not found", eventID))
+			return
+		}
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to get event", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newScoreEventStatusResponse(status))
+}
+
+// ListDeadLettersHandler responds with a page of the dead-lettered events, oldest dead-lettered first
+func (h *HTTPHandler) ListDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid limit parameter", "limit must be a positive integer")
+			return
+		}
+	}
+	offset := 0
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		var err error
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid offset parameter", "offset must be a non-negative integer")
+			return
+		}
+	}
+
+	statuses, total, err := h.service.ListDeadLetters(r.Context(), offset, limit)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to list dead letters", err.Error())
+		return
+	}
+
+	response := DeadLettersResponse{Events: make([]ScoreEventStatusResponse, len(statuses)), Total: total}
+	for i, status := range statuses {
+		response.Events[i] = newScoreEventStatusResponse(status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetDeadLetterHandler responds with a dead-lettered event, its attempts and last error
+func (h *HTTPHandler) GetDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	eventID := r.PathValue("event_id")
+
+	status, err := h.service.GetDeadLetter(r.Context(), eventID)
+	if err != nil {
+		if err == ErrScoreEventNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Dead letter not found", fmt.Sprintf("Event with ID '%s' is not dead-lettered", eventID))
+			return
+		}
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to get dead letter", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newScoreEventStatusResponse(status))
+}
+
+// RequeueDeadLettersHandler moves dead-lettered events back to the outbox with their attempts reset.
+// It requeues the event in the path, the events in the body, or all dead-lettered events if the body asks for all.
+func (h *HTTPHandler) RequeueDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	h.deadLettersAction(w, r, "requeue", h.service.RequeueDeadLetters, h.service.RequeueAllDeadLetters)
+}
+
+// PurgeDeadLettersHandler deletes the event in the path, the events in the body, or all dead-lettered events
+// if the body asks for all
+func (h *HTTPHandler) PurgeDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	h.deadLettersAction(w, r, "purge", h.service.PurgeDeadLetters, h.service.PurgeAllDeadLetters)
+}
+
+// deadLettersAction applies action to the events of the request, or allAction if the request asks for all of them
+func (h *HTTPHandler) deadLettersAction(w http.ResponseWriter, r *http.Request, name string,
+	action func(context.Context, []string) ([]string, error), allAction func(context.Context) ([]string, error)) {
+	var eventIDs []string
+	all := false
+	if eventID := r.PathValue("event_id"); eventID != "" {
+		eventIDs = []string{eventID}
+	} else {
+		var req DeadLettersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON", `body must be {"event_ids": [...]} or {"all": true}: `+err.Error())
+			return
+		}
+		if req.All && len(req.EventIDs) > 0 {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid request", "event_ids and all can't be combined")
+			return
+		}
+		if !req.All && len(req.EventIDs) == 0 {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid request", fmt.Sprintf(`event_ids is empty, {"all": true} is required to %s all dead letters`, name))
+			return
+		}
+		eventIDs, all = req.EventIDs, req.All
+	}
+
+	var applied []string
+	var err error
+	if all {
+		applied, err = allAction(r.Context())
+	} else {
+		applied, err = action(r.Context(), eventIDs)
+	}
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Failed to %s dead letters", name), err.Error())
+		return
+	}
+	if len(applied) == 0 && r.PathValue("event_id") != "" {
+		writeErrorResponse(w, http.StatusNotFound, "Dead letter not found", fmt.Sprintf("Event with ID '%s' is not dead-lettered", eventIDs[0]))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DeadLettersActionResponse{EventIDs: append([]string{}, applied...), Count: len(applied)})
+}
+
+// RetractEventHandler withdraws an event, and removes its score from the rankings. The reason query parameter is kept in the audit trail.
+func (h *HTTPHandler) RetractEventHandler(w http.ResponseWriter, r *http.Request) {
+	eventID := r.PathValue("event_id")
+
+	correction, err := h.service.RetractScoreEvent(r.Context(), eventID, r.URL.Query().Get("reason"))
+	if err != nil {
+		writeCorrectionError(w, eventID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newEventCorrectionResponse(correction))
+}
+
+// CorrectEventHandler changes the given fields of an event, and replaces its score with the score of the corrected event
+func (h *HTTPHandler) CorrectEventHandler(w http.ResponseWriter, r *http.Request) {
+	eventID := r.PathValue("event_id")
+
+	var req CorrectEventRequest
+	decoder := json.NewDecoder(r.Body)
+	if h.opts.Validation.StrictJSON {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&req); err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+
+	status, err := h.service.GetScoreEventStatus(r.Context(), eventID)
+	if err != nil {
+		writeCorrectionError(w, eventID, err)
+		return
+	}
+
+	event := status.Event
+	if req.TalentID != nil {
+		event.TalentID = TalentID(*req.TalentID)
+	}
+	if req.RawMetric != nil {
+		event.MetricValue = *req.RawMetric
+	}
+	if req.Skill != nil {
+		event.Skill = Skill(*req.Skill)
+	}
+	if req.Timestamp != nil {
+		event.Timestamp = *req.Timestamp
+	}
+	if event == status.Event {
+		writeErrorResponse(w, http.StatusBadRequest, "Nothing to correct", "at least one of talent_id, raw_metric, skill and ts must be changed")
+		return
+	}
+
+	var validationErr *ValidationError
+	if errors.As(h.validator.Validate(event), &validationErr) {
+		// An unchanged timestamp may have aged past the maximum event age since the event was received
+		var violations []FieldViolation
+		for _, violation := range validationErr.Violations {
+			if violation.Field != "ts" || req.Timestamp != nil {
+				violations = append(violations, violation)
+			}
+		}
+		if len(violations) > 0 {
+			validationErr = &ValidationError{Violations: violations}
+			writeJSONResponse(w, http.StatusUnprocessableEntity, ErrorResponse{
+				Error:      "Invalid event",
+				Message:    validationErr.Error(),
+				Violations: validationErr.Violations,
+			})
+			return
+		}
+	}
+
+	correction, err := h.service.CorrectScoreEvent(r.Context(), event, req.Reason)
+	if err != nil {
+		writeCorrectionError(w, eventID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newEventCorrectionResponse(correction))
+}
+
+func writeCorrectionError(w http.ResponseWriter, eventID string, err error) {
+	switch err {
+	case ErrScoreEventNotFound:
+		writeErrorResponse(w, http.StatusNotFound, "Event not found", fmt.Sprintf("Event with ID '%s' not found", eventID))
+	case ErrScoreEventRetracted:
+		writeErrorResponse(w, http.StatusConflict, "Event retracted", fmt.Sprintf("Event with ID '%s' is retracted", eventID))
+	default:
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to change event", err.Error())
+	}
+}
+
+func newScoreEventStatusResponse(status ScoreEventStatus) ScoreEventStatusResponse {
+	response := ScoreEventStatusResponse{
+		Event:       newEventRequest(status.Event),
+		Status:      string(status.State),
+		Attempts:    status.Attempts,
+		LastError:   status.LastError,
+		TalentScore: newEventTalentScoreResponse(status.TalentScore),
+	}
+	if !status.NextAttemptAt.IsZero() {
+		response.NextAttemptAt = &status.NextAttemptAt
+	}
+	if status.LeasedBy != "" {
+		response.LeasedBy = status.LeasedBy
+		response.LeaseExpiresAt = &status.LeaseExpiresAt
+	}
+	if !status.DeadLetteredAt.IsZero() {
+		response.DeadLetteredAt = &status.DeadLetteredAt
+	}
+	for _, correction := range status.Corrections {
+		response.Corrections = append(response.Corrections, newEventCorrectionResponse(correction))
+	}
+	return response
+}
+
+func newEventRequest(event ScoreEvent) CreateEventRequest {
+	return CreateEventRequest{
+		EventID:   event.EventID,
+		TalentID:  string(event.TalentID),
+		RawMetric: event.MetricValue,
+		Skill:     string(event.Skill),
+		Timestamp: event.Timestamp,
+	}
+}
+
+func newEventTalentScoreResponse(score *TalentScore) *EventTalentScoreResponse {
+	if score == nil {
+		return nil
+	}
+	return &EventTalentScoreResponse{
+		Score:  score.Score,
+		Season: score.Season,
+	}
+}
+
+func newEventCorrectionResponse(correction EventCorrection) EventCorrectionResponse {
+	response := EventCorrectionResponse{
+		Action:        string(correction.Action),
+		Reason:        correction.Reason,
+		At:            correction.At,
+		Previous:      newEventRequest(correction.Previous),
+		PreviousScore: newEventTalentScoreResponse(correction.PreviousScore),
+		Score:         newEventTalentScoreResponse(correction.Score),
+	}
+	if correction.Corrected != nil {
+		corrected := newEventRequest(*correction.Corrected)
+		response.Corrected = &corrected
+	}
+	return response
+}
+
 func (h *HTTPHandler) GetLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
 	limitStr := r.URL.Query().Get("limit")
 	limit := 10 // default limit
@@ -110,17 +837,52 @@ func (h *HTTPHandler) GetLeaderboardHandler(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	talents, err := h.service.GetTopTalents(r.Context(), limit)
+	req := LeaderboardPageRequest{Limit: limit}
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid offset parameter", "offset must be a non-negative integer")
+			return
+		}
+		req.Offset = offset
+	}
+	if cursorStr := r.URL.Query().Get("cursor"); cursorStr != "" {
+		if r.URL.Query().Has("offset") {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid pagination", "offset and cursor can't be used together")
+			return
+		}
+		cursor, err := decodeLeaderboardCursor(cursorStr)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid cursor parameter", "cursor must be a next_cursor returned by a previous page")
+			return
+		}
+		req.After = &cursor
+	}
+
+	key, ok := h.parseLeaderboardKey(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := h.service.GetLeaderboardPage(r.Context(), key, req)
+	if errors.Is(err, ErrSeasonNotFound) {
+		writeErrorResponse(w, http.StatusNotFound, "Season not found", fmt.Sprintf("Season '%d' not found", key.Season))
+		return
+	}
 	if err != nil {
 		writeErrorResponse(w, http.StatusInternalServerError, "Failed to get leaderboard", err.Error())
 		return
 	}
 
-	response := LeaderboardResponse{
-		Talents: make([]TalentRankResponse, len(talents)),
+	response := LeaderboardPageResponse{
+		Talents: make([]TalentRankResponse, len(page.Talents)),
+		Total:   page.Total,
+	}
+	if page.Next != nil {
+		response.NextCursor = encodeLeaderboardCursor(*page.Next)
 	}
 
-	for i, talent := range talents {
+	for i, talent := range page.Talents {
 		response.Talents[i] = TalentRankResponse{
 			Rank:     talent.Rank,
 			TalentID: string(talent.TalentID),
@@ -139,32 +901,378 @@ func (h *HTTPHandler) GetTalentRankHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	talentRank, err := h.service.GetTalentRank(r.Context(), TalentID(talentID))
-	if err != nil {
+	key, ok := h.parseLeaderboardKey(w, r)
+	if !ok {
+		return
+	}
+
+	writeError := func(err error) {
 		if err == ErrTalentNotFound {
 			writeErrorResponse(w, http.StatusNotFound, "Talent not found", fmt.Sprintf("Talent with ID '%s' not found in leaderboard", talentID))
 			return
 		}
+		if errors.Is(err, ErrSeasonNotFound) {
+			writeErrorResponse(w, http.StatusNotFound, "Season not found", fmt.Sprintf("Season '%d' not found", key.Season))
+			return
+		}
 		writeErrorResponse(w, http.StatusInternalServerError, "Failed to get talent rank", err.Error())
+	}
+
+	estimate, err := h.service.EstimateTalentRank(r.Context(), key, TalentID(talentID), h.opts.ExactRankLimit)
+	if err != nil {
+		writeError(err)
 		return
 	}
 
 	response := GetTalentRankResponse{
-		Rank:     talentRank.Rank,
-		TalentID: string(talentRank.TalentID),
-		Score:    talentRank.TalentScore.Score,
+		Rank:       estimate.Rank,
+		TalentID:   string(estimate.TalentID),
+		Score:      estimate.Score,
+		Percentile: estimate.Percentile(),
+	}
+
+	if limit := h.opts.ExactRankLimit; limit > 0 && estimate.Rank > limit {
+		response.RankBucket = rankBucket(estimate.Rank, limit)
+	}
+
+	if estimate.Exact {
+		previous, found, err := h.service.GetPreviousRank(r.Context(), key, TalentID(talentID))
+		if err != nil {
+			writeError(err)
+			return
+		}
+		if found {
+			delta := previous.Rank - estimate.Rank
+			response.PreviousRank = previous.Rank
+			response.Delta = &delta
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// leaderboardCursorJSON is the wire format of a LeaderboardCursor. Clients get it base64 encoded and treat it as opaque.
+type leaderboardCursorJSON struct {
+	Score     int       `json:"s"`
+	Timestamp time.Time `json:"a"`
+	TalentID  string    `json:"t"`
+}
+
+func encodeLeaderboardCursor(cursor LeaderboardCursor) string {
+	data, _ := json.Marshal(leaderboardCursorJSON{Score: cursor.Score, Timestamp: cursor.Timestamp, TalentID: string(cursor.TalentID)})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeLeaderboardCursor(s string) (LeaderboardCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return LeaderboardCursor{}, err
+	}
+	var cursor leaderboardCursorJSON
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return LeaderboardCursor{}, err
+	}
+	if cursor.TalentID == "" {
+		return LeaderboardCursor{}, errors.New("cursor without talent id")
+	}
+	return LeaderboardCursor{Score: cursor.Score, Timestamp: cursor.Timestamp, TalentID: TalentID(cursor.TalentID)}, nil
+}
+
+// rankBucket is the order of magnitude of a rank below the exact rank limit, e.g. "10000+" for ranks from 10001 to 100000
+func rankBucket(rank, exactRankLimit int) string {
+	bucket := exactRankLimit
+	for bucket*10 < rank {
+		bucket *= 10
+	}
+	return fmt.Sprintf("%d+", bucket)
+}
+
+// maxNeighbors is the maximum number of talents that can be requested above or below a talent
+const maxNeighbors = 100
+
+// GetTalentNeighborsHandler responds with the talents ranked right above and below the given talent, including itself
+func (h *HTTPHandler) GetTalentNeighborsHandler(w http.ResponseWriter, r *http.Request) {
+	talentID := r.PathValue("talent_id")
+	if talentID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Missing talent_id", "talent_id is required in the URL path")
+		return
+	}
+
+	above, ok := parseNeighborCount(w, r, "above")
+	if !ok {
+		return
+	}
+	below, ok := parseNeighborCount(w, r, "below")
+	if !ok {
+		return
+	}
+
+	key, ok := h.parseLeaderboardKey(w, r)
+	if !ok {
+		return
+	}
+
+	talents, err := h.service.GetTalentNeighbors(r.Context(), key, TalentID(talentID), above, below)
+	if err != nil {
+		if err == ErrTalentNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Talent not found", fmt.Sprintf("Talent with ID '%s' not found in leaderboard", talentID))
+			return
+		}
+		if errors.Is(err, ErrSeasonNotFound) {
+			writeErrorResponse(w, http.StatusNotFound, "Season not found", fmt.Sprintf("Season '%d' not found", key.Season))
+			return
+		}
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to get talent neighbors", err.Error())
+		return
+	}
+
+	response := LeaderboardResponse{
+		Talents: make([]TalentRankResponse, len(talents)),
+	}
+	for i, talent := range talents {
+		response.Talents[i] = TalentRankResponse{
+			Rank:     talent.Rank,
+			TalentID: string(talent.TalentID),
+			Score:    talent.TalentScore.Score,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseNeighborCount parses the above/below query parameter, which defaults to 5
+func parseNeighborCount(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	str := r.URL.Query().Get(name)
+	if str == "" {
+		return 5, true
+	}
+	count, err := strconv.Atoi(str)
+	if err != nil || count < 0 || count > maxNeighbors {
+		writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s parameter", name), fmt.Sprintf("%s must be an integer between 0 and %d", name, maxNeighbors))
+		return 0, false
+	}
+	return count, true
+}
+
+func (h *HTTPHandler) GetTalentProfileHandler(w http.ResponseWriter, r *http.Request) {
+	talentID := r.PathValue("talent_id")
+	if talentID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Missing talent_id", "talent_id is required in the URL path")
+		return
+	}
+
+	profile, err := h.service.GetTalentProfile(r.Context(), TalentID(talentID))
+	if err != nil {
+		if err == ErrTalentNotFound {
+			writeErrorResponse(w, http.StatusNotFound, "Talent not found", fmt.Sprintf("Talent with ID '%s' has no scores", talentID))
+			return
+		}
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to get talent profile", err.Error())
+		return
+	}
+
+	response := TalentProfileResponse{
+		TalentID:   string(profile.TalentID),
+		ScoreCount: profile.ScoreCount,
+		Rank:       profile.Rank,
+		Bests:      make([]SkillBestResponse, 0, len(profile.Bests)),
+	}
+	if !profile.FirstActivityAt.IsZero() {
+		response.FirstActivityAt = &profile.FirstActivityAt
+		response.LastActivityAt = &profile.LastActivityAt
+	}
+	for _, skill := range Skills {
+		if best, ok := profile.Bests[skill]; ok {
+			response.Bests = append(response.Bests, SkillBestResponse{
+				Skill:     string(skill),
+				Score:     best.Score,
+				EventID:   best.EventID,
+				Timestamp: best.Timestamp,
+			})
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// GetRankHistoryHandler responds with the recorded ranks of the talent in the all-time leaderboard of the skill
+func (h *HTTPHandler) GetRankHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	talentID := r.PathValue("talent_id")
+	if talentID == "" {
+		writeErrorResponse(w, http.StatusBadRequest, "Missing talent_id", "talent_id is required in the URL path")
+		return
+	}
+
+	query := r.URL.Query()
+	skill := Skill(query.Get("skill"))
+	if skill != "" && !skill.IsValid() {
+		writeErrorResponse(w, http.StatusBadRequest, "Invalid skill parameter", "skill must be one of: dribble, shoot, pass")
+		return
+	}
+
+	var from, to time.Time
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := query.Get(name); v != "" {
+			var err error
+			*t, err = h.parseTime(v)
+			if err != nil {
+				writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s parameter", name), fmt.Sprintf("%s must be a date (2025-01-27) or an RFC3339 timestamp", name))
+				return
+			}
+		}
+	}
+
+	points, err := h.service.GetRankHistory(r.Context(), skill, TalentID(talentID), from, to)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to get rank history", err.Error())
+		return
+	}
+
+	response := RankHistoryResponse{
+		TalentID: talentID,
+		Skill:    string(skill),
+		Points:   make([]RankHistoryPointResponse, len(points)),
+	}
+	for i, point := range points {
+		response.Points[i] = RankHistoryPointResponse{
+			At:     point.At,
+			Season: point.Season,
+			Rank:   point.Rank,
+			Score:  point.Score,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *HTTPHandler) GetSeasonsHandler(w http.ResponseWriter, r *http.Request) {
+	seasons, err := h.service.GetSeasons(r.Context())
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to get seasons", err.Error())
+		return
+	}
+
+	response := SeasonsResponse{
+		Seasons: make([]SeasonResponse, len(seasons)),
+	}
+	for i, season := range seasons {
+		response.Seasons[i] = newSeasonResponse(season)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CloseSeasonHandler archives the current season and starts a new one. Responds with the archived season.
+func (h *HTTPHandler) CloseSeasonHandler(w http.ResponseWriter, r *http.Request) {
+	season, err := h.service.CloseSeason(r.Context())
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, "Failed to close season", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSeasonResponse(season))
+}
+
 // Helper functions
+
+// adminOnly rejects requests without the admin token. Without a configured token, it rejects every request,
+// unless the admin endpoints are explicitly open.
+func (h *HTTPHandler) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.opts.AdminToken == "" && !h.opts.AdminOpen {
+			writeErrorResponse(w, http.StatusForbidden, "Admin endpoints disabled", "set CUJU_ADMIN_TOKEN to enable admin endpoints")
+			return
+		}
+		if h.opts.AdminToken != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.opts.AdminToken)) != 1 {
+				writeErrorResponse(w, http.StatusUnauthorized, "Unauthorized", "a valid admin token is required")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func newSeasonResponse(season Season) SeasonResponse {
+	response := SeasonResponse{ID: season.ID}
+	if !season.StartedAt.IsZero() {
+		response.StartedAt = &season.StartedAt
+	}
+	if !season.EndedAt.IsZero() {
+		response.EndedAt = &season.EndedAt
+	}
+	return response
+}
+
+// parseLeaderboardKey reads the leaderboard to use from the query parameters.
+// It writes an error response and returns false if they're invalid.
+func (h *HTTPHandler) parseLeaderboardKey(w http.ResponseWriter, r *http.Request) (LeaderboardKey, bool) {
+	var key LeaderboardKey
+	query := r.URL.Query()
+
+	// Archived seasons only have the final all-time standings, so window and at don't apply to them
+	if seasonID := r.PathValue("season_id"); seasonID != "" {
+		var err error
+		key.Season, err = strconv.Atoi(seasonID)
+		if err != nil || key.Season <= 0 {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid season_id", "season_id must be a positive integer")
+			return LeaderboardKey{}, false
+		}
+	}
+
+	if skill := query.Get("skill"); skill != "" {
+		key.Skill = Skill(skill)
+		if !key.Skill.IsValid() {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid skill parameter", "skill must be one of: dribble, shoot, pass")
+			return LeaderboardKey{}, false
+		}
+	}
+
+	if window := query.Get("window"); window != "" && key.Season == 0 {
+		var err error
+		key.Window, err = ParseWindow(window)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid window parameter", err.Error())
+			return LeaderboardKey{}, false
+		}
+	}
+
+	if at := query.Get("at"); at != "" && key.Season == 0 {
+		var err error
+		key.At, err = h.parseTime(at)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "Invalid at parameter", "at must be a date (2025-01-27) or an RFC3339 timestamp")
+			return LeaderboardKey{}, false
+		}
+	}
+
+	return key, true
+}
+
+// parseTime accepts a date, which is read in the handler's timezone, or an RFC3339 timestamp
+func (h *HTTPHandler) parseTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, s, h.opts.Location); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
 func writeErrorResponse(w http.ResponseWriter, statusCode int, error, message string) {
 	response := ErrorResponse{
 		Error:   error,
 		Message: message,
 	}
+	writeJSONResponse(w, statusCode, response)
+}
+
+func writeJSONResponse(w http.ResponseWriter, statusCode int, response any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(response)
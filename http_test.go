@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer serves the routes of a handler over an in-memory storage
+func newTestServer(t *testing.T, opts HTTPOptions) (*httptest.Server, *InMemStorage) {
+	storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime})
+	t.Cleanup(func() { storage.Close() })
+	return serveTestHandler(t, storage, opts), storage
+}
+
+func serveTestHandler(t *testing.T, storage Storage, opts HTTPOptions) *httptest.Server {
+	server := httptest.NewServer(NewHTTPHandler(NewService(storage, NewLinearScorer()), opts).SetupRoutes())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testEventJSON(eventID string, rawMetric int) string {
+	return fmt.Sprintf(`{"event_id":%q,"talent_id":"talent-1","raw_metric":%d,"skill":"dribble","ts":"2025-01-01T10:00:00Z"}`, eventID, rawMetric)
+}
+
+func TestHTTPHandler_CreateEventsBatch(t *testing.T) {
+	post := func(t *testing.T, server *httptest.Server, body string) *http.Response {
+		resp, err := http.Post(server.URL+"/events:batch", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	t.Run("responds with the outcome of every event", func(t *testing.T) {
+		server, storage := newTestServer(t, HTTPOptions{})
+
+		resp := post(t, server, "["+testEventJSON("event-1", 10)+","+testEventJSON("event-2", 20)+"]")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body := "[" + strings.Join([]string{
+			testEventJSON("event-1", 10),
+			testEventJSON("event-2", 30),
+			testEventJSON("event-3", 40),
+			`{"event_id":"event-4","talent_id":"talent-1","raw_metric":50,"skill":"juggle","ts":"2025-01-01T10:00:00Z"}`,
+			testEventJSON("event-3", 40),
+		}, ",") + "]"
+		resp = post(t, server, body)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var response BatchEventsResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		require.Len(t, response.Results, 5)
+		statuses := make([]BatchEventStatus, len(response.Results))
+		for i, result := range response.Results {
+			assert.Equal(t, i, result.Index)
+			statuses[i] = result.Status
+		}
+		assert.Equal(t, []BatchEventStatus{BatchEventDuplicate, BatchEventConflict, BatchEventAccepted, BatchEventInvalid, BatchEventDuplicate}, statuses)
+		assert.Equal(t, "event-4", response.Results[3].EventID)
+		assert.NotEmpty(t, response.Results[3].Violations)
+		assert.Equal(t, 1, response.Accepted)
+		assert.Equal(t, 2, response.Duplicates)
+		assert.Equal(t, 1, response.Conflicts)
+		assert.Equal(t, 1, response.Invalid)
+
+		_, found, err := storage.GetScoreEventStatus(t.Context(), "event-3")
+		require.NoError(t, err)
+		assert.True(t, found)
+	})
+
+	t.Run("rejects a batch with too many events", func(t *testing.T) {
+		server, storage := newTestServer(t, HTTPOptions{})
+
+		items := make([]string, maxBatchSize+1)
+		for i := range items {
+			items[i] = testEventJSON(fmt.Sprintf("event-%d", i), 10)
+		}
+		resp := post(t, server, "["+strings.Join(items, ",")+"]")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+		// Nothing of a rejected batch is saved
+		_, found, err := storage.GetScoreEventStatus(t.Context(), "event-0")
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		resp = post(t, server, "["+strings.Join(items[:maxBatchSize], ",")+"]")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("rejects a body over the size limit", func(t *testing.T) {
+		server, _ := newTestServer(t, HTTPOptions{})
+
+		padding := strings.Repeat(" ", maxBatchBytes)
+		resp := post(t, server, "["+testEventJSON("event-1", 10)+padding+"]")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	})
+
+	t.Run("rejects a body that's not an array", func(t *testing.T) {
+		server, _ := newTestServer(t, HTTPOptions{})
+
+		resp := post(t, server, testEventJSON("event-1", 10))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp = post(t, server, "["+testEventJSON("event-1", 10))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+// chunkRecordingStorage records the number of events of every SaveScoreEvents call
+type chunkRecordingStorage struct {
+	*InMemStorage
+
+	mu     sync.Mutex
+	chunks []int
+}
+
+func (s *chunkRecordingStorage) SaveScoreEvents(ctx context.Context, events []ScoreEvent) ([]SaveResult, error) {
+	s.mu.Lock()
+	s.chunks = append(s.chunks, len(events))
+	s.mu.Unlock()
+	return s.InMemStorage.SaveScoreEvents(ctx, events)
+}
+
+// failingStorage fails to save any batch
+type failingStorage struct {
+	*InMemStorage
+}
+
+func (s *failingStorage) SaveScoreEvents(ctx context.Context, events []ScoreEvent) ([]SaveResult, error) {
+	// Give the stream reader time to wait for the next line, as it would with a slow client
+	time.Sleep(50 * time.Millisecond)
+	return nil, errors.New("disk full")
+}
+
+// watchedBody counts the reads of a request body that are in progress, and the reads started after the handler returned
+type watchedBody struct {
+	io.ReadCloser
+
+	reading   atomic.Int32
+	returned  atomic.Bool
+	lateReads atomic.Int32
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	if b.returned.Load() {
+		b.lateReads.Add(1)
+	}
+	b.reading.Add(1)
+	defer b.reading.Add(-1)
+	return b.ReadCloser.Read(p)
+}
+
+// streamLine is a line of the POST /events/stream response, either the result of an event or an error
+type streamLine struct {
+	BatchEventResult
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+func decodeStreamLines(t *testing.T, body io.Reader) []streamLine {
+	var lines []streamLine
+	decoder := json.NewDecoder(body)
+	for {
+		var line streamLine
+		err := decoder.Decode(&line)
+		if err == io.EOF {
+			return lines
+		}
+		require.NoError(t, err)
+		lines = append(lines, line)
+	}
+}
+
+func TestHTTPHandler_CreateEventsStream(t *testing.T) {
+	postStream := func(t *testing.T, server *httptest.Server, body io.Reader) *http.Response {
+		resp, err := http.Post(server.URL+"/events/stream", "application/x-ndjson", body)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	t.Run("streams results back while the request is still being sent", func(t *testing.T) {
+		server, _ := newTestServer(t, HTTPOptions{})
+
+		body, writer := io.Pipe()
+		defer writer.Close()
+		go io.WriteString(writer, testEventJSON("event-1", 10)+"\n")
+
+		// The response only starts once the first line is saved, and the request body is still open then
+		resp := postStream(t, server, body)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		decoder := json.NewDecoder(resp.Body)
+
+		var line streamLine
+		require.NoError(t, decoder.Decode(&line))
+		assert.Equal(t, 0, line.Index)
+		assert.Equal(t, BatchEventAccepted, line.Status)
+
+		go func() {
+			io.WriteString(writer, testEventJSON("event-1", 10)+"\n")
+			writer.Close()
+		}()
+		require.NoError(t, decoder.Decode(&line))
+		assert.Equal(t, 1, line.Index)
+		assert.Equal(t, BatchEventDuplicate, line.Status)
+		assert.ErrorIs(t, decoder.Decode(&line), io.EOF)
+	})
+
+	t.Run("saves lines in chunks", func(t *testing.T) {
+		storage := &chunkRecordingStorage{InMemStorage: NewInMemStorageWithOptions(InMemStorageOptions{})}
+		t.Cleanup(func() { storage.Close() })
+		server := serveTestHandler(t, storage, HTTPOptions{})
+
+		var body strings.Builder
+		for i := range 2*streamChunkSize + 50 {
+			body.WriteString(testEventJSON(fmt.Sprintf("event-%d", i), 10) + "\n")
+			if i == 10 {
+				// Blank lines are skipped, without a result
+				body.WriteString("\n")
+			}
+		}
+		resp := postStream(t, server, strings.NewReader(body.String()))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		lines := decodeStreamLines(t, resp.Body)
+		require.Len(t, lines, 2*streamChunkSize+50)
+		for i, line := range lines {
+			assert.Equal(t, i, line.Index)
+			assert.Equal(t, fmt.Sprintf("event-%d", i), line.EventID)
+			assert.Equal(t, BatchEventAccepted, line.Status)
+		}
+
+		storage.mu.Lock()
+		defer storage.mu.Unlock()
+		saved := 0
+		for _, chunk := range storage.chunks {
+			assert.LessOrEqual(t, chunk, streamChunkSize)
+			saved += chunk
+		}
+		assert.Equal(t, 2*streamChunkSize+50, saved)
+		assert.GreaterOrEqual(t, len(storage.chunks), 3)
+	})
+
+	t.Run("ends with an error line if the body can't be read", func(t *testing.T) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{})
+		t.Cleanup(func() { storage.Close() })
+		handler := NewHTTPHandler(NewService(storage, NewLinearScorer()), HTTPOptions{})
+
+		body := io.MultiReader(
+			strings.NewReader(testEventJSON("event-1", 10)+"\n"+testEventJSON("event-2", 10)+"\n"),
+			iotest.ErrReader(errors.New("connection reset")),
+		)
+		req := httptest.NewRequest(http.MethodPost, "/events/stream", body)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		rec := httptest.NewRecorder()
+		handler.CreateEventsStreamHandler(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		lines := decodeStreamLines(t, rec.Body)
+		require.Len(t, lines, 3)
+		assert.Equal(t, BatchEventAccepted, lines[0].Status)
+		assert.Equal(t, BatchEventAccepted, lines[1].Status)
+		assert.Equal(t, "Failed to read stream", lines[2].Error)
+		assert.Equal(t, "connection reset", lines[2].Message)
+	})
+
+	t.Run("stops reading the body when it returns early", func(t *testing.T) {
+		storage := &failingStorage{InMemStorage: NewInMemStorageWithOptions(InMemStorageOptions{})}
+		t.Cleanup(func() { storage.Close() })
+		handler := NewHTTPHandler(NewService(storage, NewLinearScorer()), HTTPOptions{})
+
+		watched := &watchedBody{}
+		var readingOnReturn atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			watched.ReadCloser = r.Body
+			r.Body = watched
+			handler.CreateEventsStreamHandler(w, r)
+			readingOnReturn.Store(watched.reading.Load())
+			watched.returned.Store(true)
+		}))
+		t.Cleanup(server.Close)
+
+		body, writer := io.Pipe()
+		defer writer.Close()
+		go io.WriteString(writer, testEventJSON("event-1", 10)+"\n")
+
+		resp := postStream(t, server, body)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		lines := decodeStreamLines(t, resp.Body)
+		require.Len(t, lines, 1)
+		assert.Equal(t, "Failed to save events", lines[0].Error)
+
+		// The client is still sending, but nothing reads its lines anymore
+		go io.WriteString(writer, testEventJSON("event-2", 10)+"\n")
+		time.Sleep(50 * time.Millisecond)
+		assert.Zero(t, readingOnReturn.Load(), "the body was still being read when the handler returned")
+		assert.Zero(t, watched.lateReads.Load(), "the body was read after the handler returned")
+	})
+
+	t.Run("stops at a line over the size limit", func(t *testing.T) {
+		server, storage := newTestServer(t, HTTPOptions{})
+
+		body := testEventJSON("event-1", 10) + "\n" +
+			`{"event_id":"` + strings.Repeat("a", maxStreamLineBytes) + `"}` + "\n" +
+			testEventJSON("event-3", 10) + "\n"
+		resp := postStream(t, server, strings.NewReader(body))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		lines := decodeStreamLines(t, resp.Body)
+		require.Len(t, lines, 2)
+		assert.Equal(t, BatchEventAccepted, lines[0].Status)
+		assert.Equal(t, "Failed to read stream", lines[1].Error)
+		assert.Contains(t, lines[1].Message, "too long")
+
+		_, found, err := storage.GetScoreEventStatus(t.Context(), "event-3")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("rejects other content types", func(t *testing.T) {
+		server, _ := newTestServer(t, HTTPOptions{})
+
+		resp, err := http.Post(server.URL+"/events/stream", "application/json", strings.NewReader(testEventJSON("event-1", 10)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+}
+
+func TestHTTPHandler_AdminOnly(t *testing.T) {
+	retract := func(t *testing.T, server *httptest.Server, eventID, token string) int {
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/events/"+eventID, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	saveEvent := func(t *testing.T, storage *InMemStorage, eventID string) {
+		_, err := storage.SaveScoreEvent(t.Context(), ScoreEvent{EventID: eventID, TalentID: "talent-1", MetricValue: 10, Skill: SkillDribble})
+		require.NoError(t, err)
+	}
+
+	t.Run("admin endpoints are disabled without a token", func(t *testing.T) {
+		server, storage := newTestServer(t, HTTPOptions{})
+		saveEvent(t, storage, "event-1")
+
+		assert.Equal(t, http.StatusForbidden, retract(t, server, "event-1", ""))
+		assert.Equal(t, http.StatusForbidden, retract(t, server, "event-1", "guess"))
+
+		status, _, err := storage.GetScoreEventStatus(t.Context(), "event-1")
+		require.NoError(t, err)
+		assert.Equal(t, ScoreEventPending, status.State)
+	})
+
+	t.Run("admin endpoints require the token", func(t *testing.T) {
+		server, storage := newTestServer(t, HTTPOptions{AdminToken: "secret"})
+		saveEvent(t, storage, "event-1")
+
+		assert.Equal(t, http.StatusUnauthorized, retract(t, server, "event-1", ""))
+		assert.Equal(t, http.StatusUnauthorized, retract(t, server, "event-1", "guess"))
+		assert.Equal(t, http.StatusOK, retract(t, server, "event-1", "secret"))
+	})
+
+	t.Run("admin endpoints can be opened explicitly", func(t *testing.T) {
+		server, storage := newTestServer(t, HTTPOptions{AdminOpen: true})
+		saveEvent(t, storage, "event-1")
+
+		assert.Equal(t, http.StatusOK, retract(t, server, "event-1", ""))
+	})
+}
+
+func TestHTTPHandler_DeadLetters(t *testing.T) {
+	setup := func(t *testing.T) (*httptest.Server, *InMemStorage) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{MaxAttempts: 1})
+		t.Cleanup(func() { storage.Close() })
+		ctx := t.Context()
+
+		for _, eventID := range []string{"event-1", "event-2", "event-3"} {
+			_, err := storage.SaveScoreEvent(ctx, ScoreEvent{EventID: eventID, TalentID: "talent-1", MetricValue: 10, Skill: SkillDribble})
+			require.NoError(t, err)
+		}
+		events, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		for _, event := range events {
+			require.NoError(t, storage.MarkScoreEventFailed(ctx, "worker-1", event, errors.New("poisoned metric")))
+		}
+		return serveTestHandler(t, storage, HTTPOptions{AdminOpen: true}), storage
+	}
+	send := func(t *testing.T, server *httptest.Server, method, path, body string) (int, DeadLettersActionResponse) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var response DeadLettersActionResponse
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+		}
+		return resp.StatusCode, response
+	}
+
+	for _, route := range []struct{ method, path string }{{http.MethodPost, "/dead-letters/requeue"}, {http.MethodDelete, "/dead-letters"}} {
+		t.Run(route.method+" "+route.path+" needs the events or all", func(t *testing.T) {
+			server, storage := setup(t)
+
+			for _, body := range []string{"", "{}", `{"event_ids":[]}`, `{"all":false}`, `{"event_ids":["event-1"],"all":true}`} {
+				status, _ := send(t, server, route.method, route.path, body)
+				assert.Equal(t, http.StatusBadRequest, status, "body %q", body)
+			}
+			_, total, err := storage.ListDeadLetters(t.Context(), 0, 10)
+			require.NoError(t, err)
+			assert.Equal(t, 3, total)
+
+			status, response := send(t, server, route.method, route.path, `{"event_ids":["event-1"]}`)
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, []string{"event-1"}, response.EventIDs)
+
+			status, response = send(t, server, route.method, route.path, `{"all":true}`)
+			assert.Equal(t, http.StatusOK, status)
+			assert.ElementsMatch(t, []string{"event-2", "event-3"}, response.EventIDs)
+		})
+	}
+
+	t.Run("requeues and purges a single event without a body", func(t *testing.T) {
+		server, _ := setup(t)
+
+		status, response := send(t, server, http.MethodPost, "/dead-letters/event-1/requeue", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"event-1"}, response.EventIDs)
+
+		status, response = send(t, server, http.MethodDelete, "/dead-letters/event-2", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []string{"event-2"}, response.EventIDs)
+
+		status, _ = send(t, server, http.MethodDelete, "/dead-letters/event-2", "")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+}
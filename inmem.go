@@ -2,187 +2,1477 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 type InMemStorage struct {
 	scoreEventsMu sync.RWMutex
-	// scoreEvents is the list of all deduplicatedscore events
-	scoreEvents []ScoreEvent
-	// eventIDs for fast duplication check
-	eventIDs map[string]bool // Track EventIDs for duplicate detection
-	// processedEvents is for tracking which events have been processed by MarkScoreEventsAsProcessed func
-	processedEvents map[string]bool
+	// scoreEvents is the list of all deduplicatedscore events with their processing state, in the order of insertion
+	scoreEvents []*ScoreEventStatus
+	// eventFingerprints is the map of event ID to the fingerprint of its payload, for fast duplication and conflict checks.
+	// The fingerprint is empty for events of old snapshots that only kept the event IDs.
+	eventFingerprints map[string]string
+	// eventStatuses is the map of event ID to its entry in scoreEvents
+	eventStatuses map[string]*ScoreEventStatus
+	// outbox is the entries of scoreEvents that can be consumed, pending or failed, in the order they entered it.
+	// Its head is the low watermark of scoreEvents, every event before it is settled, so consuming never scans
+	// processed events. An event that's settled while it's in the outbox is dropped once a consume passes it.
+	outbox []*ScoreEventStatus
+	// outboxed is the set of event IDs in outbox
+	outboxed map[string]struct{}
+	// notify is closed when events are added to the outbox, it's created when a worker asks for it
+	notify chan struct{}
+	// deadLetters is the map of event ID to the dead-lettered entries of scoreEvents
+	deadLetters map[string]*ScoreEventStatus
+	// maxAttempts is the number of failed attempts after which an event is dead-lettered
+	maxAttempts int
+	// retry decides when a failed event is due again
+	retry RetryPolicy
+	// leaseTimeout is how long a claimed event stays leased to its worker
+	leaseTimeout time.Duration
 
+	// talentScoresMu must be locked before scoreEventsMu when both are held
 	talentScoresMu sync.RWMutex
 	// map of talentID to its scores
 	talentScores map[TalentID][]TalentScore
+	// currentSeason is the season new talent scores are saved in. Guarded by talentScoresMu.
+	currentSeason Season
+	// archivedSeasons is the map of closed season IDs to their final standings. Guarded by talentScoresMu.
+	archivedSeasons map[int]*archivedSeason
+	// rankHistory is the map of skill to the rank history of each talent in the all-time leaderboard of that skill,
+	// where the empty skill is the global leaderboard. Guarded by talentScoresMu.
+	rankHistory map[Skill]map[TalentID][]RankHistoryPoint
+	// rankHistoryRetention is how long points of the rank history are kept, they're kept forever if it's zero
+	rankHistoryRetention time.Duration
+	// recordRanksMu serializes recording ranks, so the points of one recording are added after the previous one
+	recordRanksMu sync.Mutex
 
-	leaderboardMu sync.RWMutex
-	// leaderboard is the sorted list of talent ranks by score, deduped by TalentID with max score.
-	// too lazy to implement skip-list, therefore I go with eventual consistency approach.
-	// this field will be recalculated once every N seconds from the talentRanks map.
-	leaderboard []TalentRank
-	// talentLeaderboardIndex is the map of talentID to its rank in the s.leaderboard.
-	// Assuming that we'll have more reads than writes, this map provides a fast way of lookup.
-	// This field is also recalculated once every N seconds same as leaderboard.
-	talentLeaderboardIndex map[TalentID]int
+	// aggregator turns the scores of a talent into the score it's ranked by
+	aggregator Aggregator
+	// location is the timezone of the time window boundaries
+	location *time.Location
+	now      func() time.Time
+
+	leaderboardMode LeaderboardMode
+	rankMode        RankMode
+	leaderboardMu   sync.RWMutex
+	// leaderboards has the global leaderboard and one leaderboard per skill, for all-time and for the current time windows.
+	// Each is the ranking of talents by their aggregated score, deduped by TalentID.
+	// In periodic mode they're immutable sortedLeaderboards, that are recalculated once every N seconds from the talentScores map.
+	// In realtime mode they're skiplistLeaderboards, that are updated on every SaveTalentScore call.
+	// Leaderboards of past windows aren't kept, they're built from talentScores when requested.
+	leaderboards map[boardKey]leaderboard
+
+	// correctionsMu serializes corrections, so each one is built from the state the previous one left
+	correctionsMu sync.Mutex
+
+	// stopRefresh stops the goroutine that refreshes the leaderboards, refreshDone is closed once it returned
+	stopRefresh chan struct{}
+	refreshDone chan struct{}
+	closeOnce   sync.Once
+}
+
+// boardKey identifies a leaderboard of a specific season and window period.
+// start and end are in unix nanoseconds, and both are zero for the all-time window.
+type boardKey struct {
+	season     int
+	skill      Skill
+	window     Window
+	start, end int64
+}
+
+// leaderboardSkills are the skills leaderboards are kept for, where the empty skill is the global leaderboard
+var leaderboardSkills = append([]Skill{""}, Skills...)
+
+// archivedSeason is a closed season with the final standings of its all-time global and skill leaderboards.
+// It's immutable once created.
+type archivedSeason struct {
+	Season
+	leaderboards map[Skill]*sortedLeaderboard
+}
+
+// includes reports whether the score counts in the leaderboard
+func (k boardKey) includes(score TalentScore) bool {
+	if score.Season != k.season {
+		return false
+	}
+	if k.skill != "" && score.Skill != k.skill {
+		return false
+	}
+	if k.window == WindowAllTime {
+		return true
+	}
+	if score.Timestamp.IsZero() {
+		return false
+	}
+	ts := score.Timestamp.UnixNano()
+	return ts >= k.start && ts < k.end
+}
+
+type InMemStorageOptions struct {
+	// LeaderboardMode is periodic by default
+	LeaderboardMode LeaderboardMode
+	// RefreshInterval specifies how often to refresh the leaderboard in periodic mode (default is 1 seconds)
+	RefreshInterval time.Duration
+	// RankMode is ordinal by default
+	RankMode RankMode
+	// Aggregator is MaxAggregator by default
+	Aggregator Aggregator
+	// Location is the timezone that daily, weekly and monthly windows follow (default is UTC)
+	Location *time.Location
+	// Now returns the current time, it's time.Now by default
+	Now func() time.Time
+	// MaxAttempts is the number of failed processing attempts after which an event is dead-lettered (default is 5)
+	MaxAttempts int
+	// Retry is the backoff of failed events, they're retried right away by default
+	Retry RetryPolicy
+	// LeaseTimeout is how long a claimed event is hidden from other workers, it should be longer than
+	// scoring a batch takes (default is 1 minute)
+	LeaseTimeout time.Duration
+	// RankHistoryRetention is how long the points of the rank history are kept, forever by default
+	RankHistoryRetention time.Duration
 }
 
 // refreshInterval specifies how often to refresh the leaderboard(default is 1 seconds)
 func NewInMemStorage(refreshInterval time.Duration) *InMemStorage {
-	storage := &InMemStorage{
-		eventIDs:        make(map[string]bool),
-		processedEvents: make(map[string]bool),
-		talentScores:    make(map[TalentID][]TalentScore),
-		leaderboard:     make([]TalentRank, 0),
+	return NewInMemStorageWithOptions(InMemStorageOptions{RefreshInterval: refreshInterval})
+}
+
+func NewInMemStorageWithOptions(opts InMemStorageOptions) *InMemStorage {
+	if opts.LeaderboardMode == "" {
+		opts.LeaderboardMode = LeaderboardModePeriodic
+	}
+	if opts.RefreshInterval == 0 {
+		opts.RefreshInterval = 1 * time.Second
+	}
+	if opts.RankMode == "" {
+		opts.RankMode = RankModeOrdinal
+	}
+	if opts.Aggregator == nil {
+		opts.Aggregator = MaxAggregator{}
+	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.LeaseTimeout == 0 {
+		opts.LeaseTimeout = 1 * time.Minute
 	}
 
-	if refreshInterval == 0 {
-		refreshInterval = 1 * time.Second
+	storage := &InMemStorage{
+		eventFingerprints:    make(map[string]string),
+		eventStatuses:        make(map[string]*ScoreEventStatus),
+		outboxed:             make(map[string]struct{}),
+		deadLetters:          make(map[string]*ScoreEventStatus),
+		maxAttempts:          opts.MaxAttempts,
+		retry:                opts.Retry,
+		leaseTimeout:         opts.LeaseTimeout,
+		talentScores:         make(map[TalentID][]TalentScore),
+		currentSeason:        Season{ID: 1},
+		archivedSeasons:      make(map[int]*archivedSeason),
+		rankHistory:          make(map[Skill]map[TalentID][]RankHistoryPoint),
+		rankHistoryRetention: opts.RankHistoryRetention,
+		aggregator:           opts.Aggregator,
+		location:             opts.Location,
+		now:                  opts.Now,
+		leaderboardMode:      opts.LeaderboardMode,
+		rankMode:             opts.RankMode,
+		stopRefresh:          make(chan struct{}),
+		refreshDone:          make(chan struct{}),
 	}
+	storage.refreshLeaderboard()
 
-	go storage.startPeriodicRefresh(refreshInterval)
+	if opts.LeaderboardMode == LeaderboardModePeriodic {
+		go storage.startPeriodicRefresh(opts.RefreshInterval)
+	} else {
+		// The first wait is computed here, so the goroutine doesn't read the clock until the day ends
+		go storage.startWindowRollover(storage.untilRollover())
+	}
 	return storage
 }
 
+// Close stops refreshing the leaderboards in the background. It's safe to call more than once.
+func (s *InMemStorage) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stopRefresh)
+		<-s.refreshDone
+	})
+	return nil
+}
+
 // SaveScoreEvent stores a score event
 // Returns true if the event was saved, false if it was a duplicate
 func (s *InMemStorage) SaveScoreEvent(ctx context.Context, event ScoreEvent) (bool, error) {
 	s.scoreEventsMu.Lock()
 	defer s.scoreEventsMu.Unlock()
 
-	if s.eventIDs[event.EventID] {
+	switch s.compareScoreEvent(event) {
+	case SaveResultDuplicate:
 		return false, nil
+	case SaveResultConflict:
+		return false, ErrScoreEventConflict
 	}
 
-	// Mark EventID as seen and save the event
-	s.eventIDs[event.EventID] = true
-	s.scoreEvents = append(s.scoreEvents, event)
+	s.saveScoreEvent(event)
 	return true, nil
 }
 
-// ConsumeScoreEvents retrieves unprocessed score events up to the specified limit
-func (s *InMemStorage) ConsumeScoreEvents(ctx context.Context, limit int) ([]ScoreEvent, error) {
-	s.scoreEventsMu.RLock()
-	defer s.scoreEventsMu.RUnlock()
+// SaveScoreEvents stores a batch of score events under a single lock
+func (s *InMemStorage) SaveScoreEvents(ctx context.Context, events []ScoreEvent) ([]SaveResult, error) {
+	s.scoreEventsMu.Lock()
+	defer s.scoreEventsMu.Unlock()
 
-	var unprocessed []ScoreEvent
-	for _, event := range s.scoreEvents {
-		if !s.processedEvents[event.EventID] {
-			unprocessed = append(unprocessed, event)
-			if len(unprocessed) >= limit {
-				break
+	results := s.compareScoreEvents(events)
+	for i, event := range events {
+		if results[i] == SaveResultSaved {
+			s.saveScoreEvent(event)
+		}
+	}
+	return results, nil
+}
+
+// saveScoreEvent must be called with scoreEventsMu held
+func (s *InMemStorage) saveScoreEvent(event ScoreEvent) {
+	// Remember the payload of the EventID and save the event
+	s.eventFingerprints[event.EventID] = scoreEventFingerprint(event)
+	status := &ScoreEventStatus{Event: event, State: ScoreEventPending}
+	s.scoreEvents = append(s.scoreEvents, status)
+	s.eventStatuses[event.EventID] = status
+	s.enqueueScoreEvent(status)
+}
+
+// enqueueScoreEvent adds the event to the end of the outbox unless it's already in it, and notifies the waiting workers.
+// It must be called with scoreEventsMu held.
+func (s *InMemStorage) enqueueScoreEvent(status *ScoreEventStatus) {
+	if _, ok := s.outboxed[status.Event.EventID]; !ok {
+		s.outbox = append(s.outbox, status)
+		s.outboxed[status.Event.EventID] = struct{}{}
+	}
+	if s.notify != nil {
+		close(s.notify)
+		s.notify = nil
+	}
+}
+
+// ScoreEventsNotify returns a channel that's closed once an event is added to the outbox.
+// Closing it wakes up every worker waiting on it, and a new channel is only made once a worker waits again.
+func (s *InMemStorage) ScoreEventsNotify() <-chan struct{} {
+	s.scoreEventsMu.Lock()
+	defer s.scoreEventsMu.Unlock()
+
+	if s.notify == nil {
+		s.notify = make(chan struct{})
+	}
+	return s.notify
+}
+
+// consumable reports whether the event can be claimed, once it's due and its lease has expired
+func consumable(status *ScoreEventStatus) bool {
+	return status.State == ScoreEventPending || status.State == ScoreEventFailed
+}
+
+// compareScoreEvent returns what saving the event would result in, it must be called with scoreEventsMu held.
+// Events of old snapshots have no fingerprint, so any event with their ID is treated as a duplicate.
+func (s *InMemStorage) compareScoreEvent(event ScoreEvent) SaveResult {
+	fingerprint, ok := s.eventFingerprints[event.EventID]
+	switch {
+	case !ok:
+		return SaveResultSaved
+	case fingerprint == "" || fingerprint == scoreEventFingerprint(event):
+		return SaveResultDuplicate
+	}
+	return SaveResultConflict
+}
+
+// compareScoreEvents returns what saving each event of the batch would result in, as if the events before it
+// were already saved. It must be called with scoreEventsMu held.
+func (s *InMemStorage) compareScoreEvents(events []ScoreEvent) []SaveResult {
+	results := make([]SaveResult, len(events))
+	// batchFingerprints is the map of the IDs saved by the batch to their fingerprints
+	batchFingerprints := make(map[string]string)
+	for i, event := range events {
+		fingerprint, ok := batchFingerprints[event.EventID]
+		switch {
+		case !ok:
+			results[i] = s.compareScoreEvent(event)
+			if results[i] == SaveResultSaved {
+				batchFingerprints[event.EventID] = scoreEventFingerprint(event)
 			}
+		case fingerprint == scoreEventFingerprint(event):
+			results[i] = SaveResultDuplicate
+		default:
+			results[i] = SaveResultConflict
+		}
+	}
+	return results
+}
+
+// scoreEventFingerprint is the SHA-256 of the event payload. The timestamp is normalized to UTC,
+// so the same instant sent with a different offset is still the same event.
+func scoreEventFingerprint(event ScoreEvent) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d\x00%s", event.EventID, event.TalentID, event.Skill, event.MetricValue,
+		event.Timestamp.UTC().Format(time.RFC3339Nano))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ConsumeScoreEvents claims up to limit unprocessed score events that are due for the worker.
+// It only scans the outbox, and stops once it has claimed limit events.
+func (s *InMemStorage) ConsumeScoreEvents(ctx context.Context, workerID string, limit int) ([]ScoreEvent, error) {
+	s.scoreEventsMu.Lock()
+	defer s.scoreEventsMu.Unlock()
+
+	now := s.now()
+	var claimed []ScoreEvent
+	// blocked is the set of talents with an earlier event that can't be claimed, so their later events wait for it
+	var blocked map[TalentID]struct{}
+	scanned := 0
+	for ; scanned < len(s.outbox) && len(claimed) < limit; scanned++ {
+		status := s.outbox[scanned]
+		if !consumable(status) {
+			delete(s.outboxed, status.Event.EventID)
+			continue
+		}
+		if _, ok := blocked[status.Event.TalentID]; ok {
+			continue
+		}
+		if status.NextAttemptAt.After(now) || status.LeaseExpiresAt.After(now) {
+			if blocked == nil {
+				blocked = make(map[TalentID]struct{})
+			}
+			blocked[status.Event.TalentID] = struct{}{}
+			continue
+		}
+		status.LeasedBy = workerID
+		status.LeaseExpiresAt = now.Add(s.leaseTimeout)
+		claimed = append(claimed, status.Event)
+	}
+
+	// Drop the settled events of the scanned part by moving the ones that stay to its end,
+	// so the cost is the scanned part, and the rest of the outbox isn't moved
+	head := scanned
+	for i := scanned - 1; i >= 0; i-- {
+		if status := s.outbox[i]; consumable(status) {
+			head--
+			s.outbox[head] = status
+		}
+	}
+	clear(s.outbox[:head])
+	s.outbox = s.outbox[head:]
+
+	return claimed, nil
+}
+
+// MarkScoreEventsAsProcessed marks the given events leased to the worker as processed
+func (s *InMemStorage) MarkScoreEventsAsProcessed(ctx context.Context, workerID string, events []ScoreEvent) error {
+	return s.markScoreEventsProcessed(workerID, scoreEventIDs(events))
+}
+
+// markScoreEventsProcessed marks the events as processed and releases their leases.
+// If workerID is set, only the events leased to the worker are marked, and the error lists the others.
+func (s *InMemStorage) markScoreEventsProcessed(workerID string, eventIDs []string) error {
+	s.scoreEventsMu.Lock()
+	defer s.scoreEventsMu.Unlock()
+
+	var err error
+	if workerID != "" {
+		eventIDs, err = s.leasedScoreEvents(workerID, eventIDs)
+	}
+	for _, eventID := range eventIDs {
+		if status, ok := s.eventStatuses[eventID]; ok && status.State != ScoreEventRetracted {
+			status.State = ScoreEventProcessed
+			status.Attempts++
+			releaseLease(status)
 		}
 	}
 
-	return unprocessed, nil
+	return err
 }
 
-// MarkScoreEventsAsProcessed marks the given events as processed
-func (s *InMemStorage) MarkScoreEventsAsProcessed(ctx context.Context, events []ScoreEvent) error {
+// ReleaseScoreEvents releases the leases of the worker on the events, they keep their place in the outbox
+func (s *InMemStorage) ReleaseScoreEvents(ctx context.Context, workerID string, events []ScoreEvent) error {
 	s.scoreEventsMu.Lock()
 	defer s.scoreEventsMu.Unlock()
 
-	for _, event := range events {
-		s.processedEvents[event.EventID] = true
+	eventIDs, err := s.leasedScoreEvents(workerID, scoreEventIDs(events))
+	for _, eventID := range eventIDs {
+		releaseLease(s.eventStatuses[eventID])
+	}
+	return err
+}
+
+func (s *InMemStorage) MarkScoreEventFailed(ctx context.Context, workerID string, event ScoreEvent, reason error) error {
+	failure := s.newScoreEventFailure(event.EventID, reason.Error())
+	failure.WorkerID = workerID
+	return s.failScoreEvent(failure)
+}
+
+// heldLeases returns the IDs of the events leased to the worker, and ErrLeaseNotHeld listing the others
+func (s *InMemStorage) heldLeases(workerID string, eventIDs []string) ([]string, error) {
+	s.scoreEventsMu.RLock()
+	defer s.scoreEventsMu.RUnlock()
+
+	return s.leasedScoreEvents(workerID, eventIDs)
+}
+
+// leasedScoreEvents is heldLeases with scoreEventsMu held.
+// The lease of an event is held by the worker that claimed it last, an expired lease is still held until another
+// worker claims the event, so a worker that's slower than the lease timeout isn't stuck retrying the event.
+func (s *InMemStorage) leasedScoreEvents(workerID string, eventIDs []string) ([]string, error) {
+	var held, lost []string
+	for _, eventID := range eventIDs {
+		if status, ok := s.eventStatuses[eventID]; ok && status.LeasedBy == workerID {
+			held = append(held, eventID)
+		} else {
+			lost = append(lost, eventID)
+		}
+	}
+	if len(lost) > 0 {
+		return held, fmt.Errorf("%w by %s: %s", ErrLeaseNotHeld, workerID, strings.Join(lost, ", "))
+	}
+	return held, nil
+}
+
+// releaseLease clears the lease of the event
+func releaseLease(status *ScoreEventStatus) {
+	status.LeasedBy = ""
+	status.LeaseExpiresAt = time.Time{}
+}
+
+func scoreEventIDs(events []ScoreEvent) []string {
+	eventIDs := make([]string, len(events))
+	for i, event := range events {
+		eventIDs[i] = event.EventID
+	}
+	return eventIDs
+}
+
+// scoreEventFailure is the outcome of a failed processing attempt. It's decided before it's applied,
+// so the file storage can log it, and replaying it doesn't depend on the clock, the jitter or the configuration.
+type scoreEventFailure struct {
+	EventID string
+	Reason  string
+	// WorkerID is the worker the event must be leased to, it's not checked if it's empty
+	WorkerID string
+	// NextAttemptAt is when the event is due again, zero if it's due right away
+	NextAttemptAt time.Time
+	// DeadLetteredAt is when the event is dead-lettered, zero if it's retried
+	DeadLetteredAt time.Time
+}
+
+// newScoreEventFailure decides when the event is retried after another failed attempt, or if it's dead-lettered
+func (s *InMemStorage) newScoreEventFailure(eventID string, reason string) scoreEventFailure {
+	s.scoreEventsMu.RLock()
+	defer s.scoreEventsMu.RUnlock()
+
+	failure := scoreEventFailure{EventID: eventID, Reason: reason}
+	status, ok := s.eventStatuses[eventID]
+	if !ok {
+		return failure
+	}
+
+	now := s.now()
+	if attempts := status.Attempts + 1; attempts >= s.maxAttempts {
+		failure.DeadLetteredAt = now
+	} else if delay := s.retry.Delay(attempts); delay > 0 {
+		failure.NextAttemptAt = now.Add(delay)
 	}
+	return failure
+}
+
+// failScoreEvent records a failed attempt of the event and releases its lease
+func (s *InMemStorage) failScoreEvent(failure scoreEventFailure) error {
+	s.scoreEventsMu.Lock()
+	defer s.scoreEventsMu.Unlock()
 
+	if failure.WorkerID != "" {
+		if _, err := s.leasedScoreEvents(failure.WorkerID, []string{failure.EventID}); err != nil {
+			return err
+		}
+	}
+	status, ok := s.eventStatuses[failure.EventID]
+	if !ok || status.State == ScoreEventRetracted || status.State == ScoreEventDeadLettered {
+		return nil
+	}
+	releaseLease(status)
+	status.State = ScoreEventFailed
+	status.Attempts++
+	status.LastError = failure.Reason
+	status.NextAttemptAt = failure.NextAttemptAt
+	if !failure.DeadLetteredAt.IsZero() {
+		status.State = ScoreEventDeadLettered
+		status.DeadLetteredAt = failure.DeadLetteredAt
+		s.deadLetters[failure.EventID] = status
+	}
 	return nil
 }
 
-// SaveTalentScore stores a talent score by appending to the talent's score list
+// ListDeadLetters returns copies of the dead-lettered events, oldest dead-lettered first
+func (s *InMemStorage) ListDeadLetters(ctx context.Context, offset, limit int) ([]ScoreEventStatus, int, error) {
+	s.scoreEventsMu.RLock()
+	defer s.scoreEventsMu.RUnlock()
+
+	ordered := s.orderedDeadLetters()
+	page := []ScoreEventStatus{}
+	for i := offset; i < len(ordered) && i < offset+limit; i++ {
+		status := *ordered[i]
+		status.Corrections = append([]EventCorrection(nil), status.Corrections...)
+		page = append(page, status)
+	}
+	return page, len(ordered), nil
+}
+
+// RequeueDeadLetters moves the given dead-lettered events back to the outbox
+func (s *InMemStorage) RequeueDeadLetters(ctx context.Context, eventIDs []string) ([]string, error) {
+	return s.requeueDeadLetters(s.findDeadLetters(eventIDs)), nil
+}
+
+// RequeueAllDeadLetters moves every dead-lettered event back to the outbox
+func (s *InMemStorage) RequeueAllDeadLetters(ctx context.Context) ([]string, error) {
+	return s.requeueDeadLetters(s.allDeadLetters()), nil
+}
+
+// PurgeDeadLetters deletes the given dead-lettered events
+func (s *InMemStorage) PurgeDeadLetters(ctx context.Context, eventIDs []string) ([]string, error) {
+	return s.purgeDeadLetters(s.findDeadLetters(eventIDs)), nil
+}
+
+// PurgeAllDeadLetters deletes every dead-lettered event
+func (s *InMemStorage) PurgeAllDeadLetters(ctx context.Context) ([]string, error) {
+	return s.purgeDeadLetters(s.allDeadLetters()), nil
+}
+
+// orderedDeadLetters returns the dead-lettered events, oldest dead-lettered first.
+// It must be called with scoreEventsMu held.
+func (s *InMemStorage) orderedDeadLetters() []*ScoreEventStatus {
+	ordered := make([]*ScoreEventStatus, 0, len(s.deadLetters))
+	for _, status := range s.deadLetters {
+		ordered = append(ordered, status)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if !ordered[i].DeadLetteredAt.Equal(ordered[j].DeadLetteredAt) {
+			return ordered[i].DeadLetteredAt.Before(ordered[j].DeadLetteredAt)
+		}
+		return ordered[i].Event.EventID < ordered[j].Event.EventID
+	})
+	return ordered
+}
+
+// allDeadLetters returns the IDs of all dead-lettered events, oldest dead-lettered first
+func (s *InMemStorage) allDeadLetters() []string {
+	s.scoreEventsMu.RLock()
+	defer s.scoreEventsMu.RUnlock()
+
+	var found []string
+	for _, status := range s.orderedDeadLetters() {
+		found = append(found, status.Event.EventID)
+	}
+	return found
+}
+
+// findDeadLetters returns the IDs of the given events that are dead-lettered
+func (s *InMemStorage) findDeadLetters(eventIDs []string) []string {
+	s.scoreEventsMu.RLock()
+	defer s.scoreEventsMu.RUnlock()
+
+	var found []string
+	for _, eventID := range eventIDs {
+		if _, ok := s.deadLetters[eventID]; ok {
+			found = append(found, eventID)
+		}
+	}
+	return found
+}
+
+// requeueDeadLetters makes the given dead-lettered events pending with no attempts.
+// Returns the IDs of the requeued ones, in case some of them aren't dead-lettered anymore.
+func (s *InMemStorage) requeueDeadLetters(eventIDs []string) []string {
+	s.scoreEventsMu.Lock()
+	defer s.scoreEventsMu.Unlock()
+
+	var requeued []string
+	for _, eventID := range eventIDs {
+		status, ok := s.deadLetters[eventID]
+		if !ok {
+			continue
+		}
+		delete(s.deadLetters, eventID)
+		status.State = ScoreEventPending
+		status.Attempts = 0
+		status.NextAttemptAt = time.Time{}
+		status.DeadLetteredAt = time.Time{}
+		s.enqueueScoreEvent(status)
+		requeued = append(requeued, eventID)
+	}
+	return requeued
+}
+
+// purgeDeadLetters deletes the given dead-lettered events, but keeps their fingerprints for deduplication.
+// Returns the IDs of the purged ones, in case some of them aren't dead-lettered anymore.
+func (s *InMemStorage) purgeDeadLetters(eventIDs []string) []string {
+	s.scoreEventsMu.Lock()
+	defer s.scoreEventsMu.Unlock()
+
+	var purged []string
+	for _, eventID := range eventIDs {
+		if _, ok := s.deadLetters[eventID]; !ok {
+			continue
+		}
+		delete(s.deadLetters, eventID)
+		delete(s.eventStatuses, eventID)
+		purged = append(purged, eventID)
+	}
+	if len(purged) == 0 {
+		return nil
+	}
+
+	scoreEvents := s.scoreEvents[:0]
+	for _, status := range s.scoreEvents {
+		if _, ok := s.eventStatuses[status.Event.EventID]; ok {
+			scoreEvents = append(scoreEvents, status)
+		}
+	}
+	clear(s.scoreEvents[len(scoreEvents):])
+	s.scoreEvents = scoreEvents
+	return purged
+}
+
+// GetScoreEventStatus returns a copy of the event's status. The talent score of a processed event is looked up by its event ID.
+func (s *InMemStorage) GetScoreEventStatus(ctx context.Context, eventID string) (ScoreEventStatus, bool, error) {
+	s.scoreEventsMu.RLock()
+	stored, ok := s.eventStatuses[eventID]
+	var status ScoreEventStatus
+	if ok {
+		status = *stored
+		status.Corrections = append([]EventCorrection(nil), stored.Corrections...)
+	}
+	s.scoreEventsMu.RUnlock()
+
+	if !ok {
+		return ScoreEventStatus{}, false, nil
+	}
+
+	if status.State == ScoreEventProcessed {
+		s.talentScoresMu.RLock()
+		for _, score := range s.talentScores[status.Event.TalentID] {
+			if score.EventID == eventID {
+				status.TalentScore = &score
+				break
+			}
+		}
+		s.talentScoresMu.RUnlock()
+	}
+
+	return status, true, nil
+}
+
+// SaveTalentScore stores a talent score by appending to the talent's score list.
+// In realtime mode the talent's position is updated right away in every leaderboard the score counts in.
 func (s *InMemStorage) SaveTalentScore(ctx context.Context, talentScore TalentScore) error {
 	s.talentScoresMu.Lock()
 	defer s.talentScoresMu.Unlock()
 
+	// The event is checked under talentScoresMu, which corrections hold while they change the event and its score.
+	// A worker whose lease expired while it was scoring the event can save a score after another worker saved one,
+	// so an event of the outbox only gets the first score saved for it.
+	s.scoreEventsMu.RLock()
+	status, ok := s.eventStatuses[talentScore.EventID]
+	scored := ok && (status.State == ScoreEventProcessed || status.State == ScoreEventRetracted)
+	s.scoreEventsMu.RUnlock()
+	if ok && !scored {
+		_, scored = findEventScore(s.talentScores[talentScore.TalentID], talentScore.EventID)
+	}
+	if scored {
+		return nil
+	}
+
+	talentScore.Season = s.currentSeason.ID
 	s.talentScores[talentScore.TalentID] = append(s.talentScores[talentScore.TalentID], talentScore)
+	s.updateRealtimeLeaderboards(talentScore)
 
 	return nil
 }
 
-func (s *InMemStorage) FindTalentRank(ctx context.Context, talentID TalentID) (TalentRank, bool, error) {
-	s.leaderboardMu.RLock()
-	defer s.leaderboardMu.RUnlock()
+// updateRealtimeLeaderboards updates the position of the score's talent in every leaderboard the score counts in.
+// It must be called with talentScoresMu held, after the score is added to or removed from the talent's scores.
+func (s *InMemStorage) updateRealtimeLeaderboards(talentScore TalentScore) {
+	if s.leaderboardMode != LeaderboardModeRealtime {
+		return
+	}
+	scores := s.talentScores[talentScore.TalentID]
+
+	s.leaderboardMu.Lock()
+	defer s.leaderboardMu.Unlock()
+	for key, board := range s.leaderboards {
+		if !key.includes(talentScore) {
+			continue
+		}
+		if entry, ok := s.talentRankEntry(scores, key); ok {
+			board.(*skiplistLeaderboard).Upsert(entry)
+		} else {
+			// Depending on the aggregator, a new score can bring the aggregate down to zero
+			board.(*skiplistLeaderboard).Remove(talentScore.TalentID)
+		}
+	}
+}
+
+// RetractScoreEvent marks the event as retracted and removes its talent score
+func (s *InMemStorage) RetractScoreEvent(ctx context.Context, eventID string, reason string) (EventCorrection, bool, error) {
+	s.correctionsMu.Lock()
+	defer s.correctionsMu.Unlock()
+
+	correction, found, err := s.newEventCorrection(eventID, nil, nil, reason)
+	if !found || err != nil {
+		return EventCorrection{}, found, err
+	}
+	s.applyEventCorrection(correction)
+	return correction, true, nil
+}
+
+// CorrectScoreEvent replaces the event and its talent score
+func (s *InMemStorage) CorrectScoreEvent(ctx context.Context, event ScoreEvent, score TalentScore, reason string) (EventCorrection, bool, error) {
+	s.correctionsMu.Lock()
+	defer s.correctionsMu.Unlock()
+
+	correction, found, err := s.newEventCorrection(event.EventID, &event, &score, reason)
+	if !found || err != nil {
+		return EventCorrection{}, found, err
+	}
+	s.applyEventCorrection(correction)
+	return correction, true, nil
+}
+
+// newEventCorrection builds the audit record of a change to the event from the current state, without applying it.
+// A nil corrected event is a retraction.
+func (s *InMemStorage) newEventCorrection(eventID string, corrected *ScoreEvent, score *TalentScore, reason string) (EventCorrection, bool, error) {
+	s.talentScoresMu.RLock()
+	defer s.talentScoresMu.RUnlock()
+
+	s.scoreEventsMu.RLock()
+	status, ok := s.eventStatuses[eventID]
+	var previous ScoreEvent
+	var state ScoreEventState
+	if ok {
+		previous, state = status.Event, status.State
+	}
+	s.scoreEventsMu.RUnlock()
 
-	leaderboardIndex, ok := s.talentLeaderboardIndex[talentID]
 	if !ok {
-		return TalentRank{}, false, nil
+		return EventCorrection{}, false, nil
+	}
+	if state == ScoreEventRetracted {
+		return EventCorrection{}, true, ErrScoreEventRetracted
 	}
 
-	return s.leaderboard[leaderboardIndex], true, nil
+	correction := EventCorrection{
+		EventID:  eventID,
+		Action:   CorrectionRetract,
+		Reason:   reason,
+		At:       s.now(),
+		Previous: previous,
+	}
+	if i, ok := findEventScore(s.talentScores[previous.TalentID], eventID); ok {
+		previousScore := s.talentScores[previous.TalentID][i]
+		correction.PreviousScore = &previousScore
+	}
+	if corrected != nil {
+		correction.Action = CorrectionCorrect
+		correction.Corrected = corrected
+		// The corrected score stays in the season of the score it replaces
+		correctedScore := *score
+		correctedScore.Season = s.currentSeason.ID
+		if correction.PreviousScore != nil {
+			correctedScore.Season = correction.PreviousScore.Season
+		}
+		correction.Score = &correctedScore
+	}
+	return correction, true, nil
+}
+
+// applyEventCorrection changes the event and its talent score as the correction says, and records it in the event's audit trail.
+// The final standings of closed seasons aren't changed.
+func (s *InMemStorage) applyEventCorrection(correction EventCorrection) {
+	s.talentScoresMu.Lock()
+	defer s.talentScoresMu.Unlock()
+
+	s.scoreEventsMu.Lock()
+	if status, ok := s.eventStatuses[correction.EventID]; ok {
+		if correction.Corrected != nil {
+			status.Event = *correction.Corrected
+			status.State = ScoreEventProcessed
+			status.LastError = ""
+		} else {
+			status.State = ScoreEventRetracted
+		}
+		status.NextAttemptAt = time.Time{}
+		status.DeadLetteredAt = time.Time{}
+		releaseLease(status)
+		delete(s.deadLetters, correction.EventID)
+		status.Corrections = append(status.Corrections, correction)
+	}
+	s.scoreEventsMu.Unlock()
+
+	// The score is looked up again rather than taken from the correction,
+	// in case a processing attempt saved one since the correction was built
+	previousTalent := correction.Previous.TalentID
+	scores := s.talentScores[previousTalent]
+	i, scored := findEventScore(scores, correction.EventID)
+	var previousScore TalentScore
+	if scored {
+		previousScore = scores[i]
+	}
+
+	if scored && correction.Score != nil && correction.Score.TalentID == previousTalent {
+		// Replace the score in place, so it keeps its position among the talent's scores
+		scores[i] = *correction.Score
+	} else {
+		if scored {
+			s.talentScores[previousTalent] = append(scores[:i:i], scores[i+1:]...)
+			if len(s.talentScores[previousTalent]) == 0 {
+				delete(s.talentScores, previousTalent)
+			}
+		}
+		if correction.Score != nil {
+			talentID := correction.Score.TalentID
+			s.talentScores[talentID] = append(s.talentScores[talentID], *correction.Score)
+		}
+	}
+
+	if scored {
+		s.updateRealtimeLeaderboards(previousScore)
+	}
+	if correction.Score != nil {
+		s.updateRealtimeLeaderboards(*correction.Score)
+	}
+}
+
+// findEventScore returns the index of the score calculated from the event
+func findEventScore(scores []TalentScore, eventID string) (int, bool) {
+	for i, score := range scores {
+		if score.EventID == eventID {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (s *InMemStorage) FindTalentRank(ctx context.Context, key LeaderboardKey, talentID TalentID) (TalentRank, bool, error) {
+	var talentRank TalentRank
+	var found bool
+	err := s.readLeaderboard(key, func(board leaderboard) {
+		talentRank, found = board.Find(talentID)
+	})
+	return talentRank, found, err
+}
+
+// EstimateTalentRank finds the exact rank in the leaderboards that are kept, as it costs about as much as an estimate.
+// Leaderboards that aren't kept would have to be sorted, so the rank is estimated from a histogram built
+// from their entries for this call, and they're only sorted for talents within exactRankLimit.
+func (s *InMemStorage) EstimateTalentRank(ctx context.Context, key LeaderboardKey, talentID TalentID, exactRankLimit int) (RankEstimate, bool, error) {
+	var estimate RankEstimate
+	var found bool
+	err := s.withLeaderboard(key, func(board leaderboard) {
+		estimate, found = exactRank(board, talentID)
+	}, func(entries []TalentRank) {
+		if exactRankLimit > 0 {
+			estimate, found = estimateRank(entries, talentID)
+			if !found || estimate.Rank > exactRankLimit {
+				return
+			}
+		}
+		estimate, found = exactRank(newSortedLeaderboard(entries, s.rankMode), talentID)
+	})
+	return estimate, found, err
+}
+
+func (s *InMemStorage) GetLeaderboardPage(ctx context.Context, key LeaderboardKey, req LeaderboardPageRequest) (LeaderboardPage, error) {
+	var page LeaderboardPage
+	err := s.readLeaderboard(key, func(board leaderboard) {
+		page = leaderboardPage(board, req)
+	})
+	return page, err
 }
 
-func (s *InMemStorage) GetTopRankedTalents(ctx context.Context, limit int) ([]TalentRank, error) {
+func (s *InMemStorage) FindTalentNeighbors(ctx context.Context, key LeaderboardKey, talentID TalentID, above, below int) ([]TalentRank, bool, error) {
+	var ranks []TalentRank
+	var found bool
+	err := s.readLeaderboard(key, func(board leaderboard) {
+		ranks, found = neighbors(board, talentID, above, below)
+	})
+	return ranks, found, err
+}
+
+func (s *InMemStorage) GetTopRankedTalents(ctx context.Context, key LeaderboardKey, limit int) ([]TalentRank, error) {
+	var ranks []TalentRank
+	err := s.readLeaderboard(key, func(board leaderboard) {
+		ranks = board.Range(0, limit)
+	})
+	return ranks, err
+}
+
+// readLeaderboard calls fn with the leaderboard of the key.
+// Leaderboards that aren't maintained, such as the ones of past windows, are built on the fly.
+// Returns ErrSeasonNotFound if the key refers to a season that doesn't exist.
+func (s *InMemStorage) readLeaderboard(key LeaderboardKey, fn func(leaderboard)) error {
+	return s.withLeaderboard(key, fn, func(entries []TalentRank) {
+		fn(newSortedLeaderboard(entries, s.rankMode))
+	})
+}
+
+// withLeaderboard calls maintained with the leaderboard of the key if it's maintained or archived,
+// and unmaintained with the unsorted entries of the leaderboard otherwise.
+// Returns ErrSeasonNotFound if the key refers to a season that doesn't exist.
+func (s *InMemStorage) withLeaderboard(key LeaderboardKey, maintained func(leaderboard), unmaintained func([]TalentRank)) error {
+	s.talentScoresMu.RLock()
+	currentSeason := s.currentSeason.ID
+	archived, isArchived := s.archivedSeasons[key.Season]
+	s.talentScoresMu.RUnlock()
+
+	if key.Season != 0 && key.Season != currentSeason {
+		if !isArchived {
+			return ErrSeasonNotFound
+		}
+		// Archived leaderboards are immutable, they need no locking
+		maintained(archived.leaderboards[key.Skill])
+		return nil
+	}
+
+	bk := s.resolveBoardKey(key, currentSeason)
+
 	s.leaderboardMu.RLock()
-	defer s.leaderboardMu.RUnlock()
+	board, ok := s.leaderboards[bk]
+	if ok {
+		maintained(board)
+		s.leaderboardMu.RUnlock()
+		return nil
+	}
+	s.leaderboardMu.RUnlock()
+
+	// leaderboardMu must not be held here, talentScoresMu is always locked first
+	s.talentScoresMu.RLock()
+	entries := s.leaderboardEntries(bk)
+	s.talentScoresMu.RUnlock()
 
-	if limit > len(s.leaderboard) {
-		limit = len(s.leaderboard)
+	unmaintained(entries)
+	return nil
+}
+
+// resolveBoardKey turns the requested window and time into the window period of the season
+func (s *InMemStorage) resolveBoardKey(key LeaderboardKey, season int) boardKey {
+	window := key.Window
+	if window == "" {
+		window = WindowAllTime
+	}
+	at := key.At
+	if at.IsZero() {
+		at = s.now()
 	}
+	return s.boardKeyAt(season, key.Skill, window, at)
+}
 
-	ranks := make([]TalentRank, limit)
-	copy(ranks, s.leaderboard[:limit])
+func (s *InMemStorage) boardKeyAt(season int, skill Skill, window Window, at time.Time) boardKey {
+	bk := boardKey{season: season, skill: skill, window: window}
+	if window != WindowAllTime {
+		start, end := window.Bounds(at, s.location)
+		bk.start, bk.end = start.UnixNano(), end.UnixNano()
+	}
+	return bk
+}
 
-	return ranks, nil
+// maintainedBoardKeys returns the keys of all leaderboards the storage keeps up to date at the given time:
+// global and skill leaderboards of the season, for all-time and the current windows
+func (s *InMemStorage) maintainedBoardKeys(season int, now time.Time) []boardKey {
+	keys := make([]boardKey, 0, len(leaderboardSkills)*len(Windows))
+	for _, skill := range leaderboardSkills {
+		for _, window := range Windows {
+			keys = append(keys, s.boardKeyAt(season, skill, window, now))
+		}
+	}
+	return keys
 }
 
-// startPeriodicRefresh starts a goroutine that refreshes the leaderboard periodically
+// startPeriodicRefresh starts a goroutine that refreshes the leaderboard periodically.
+// As every refresh builds the leaderboards of the current windows, windows roll over with it.
 func (s *InMemStorage) startPeriodicRefresh(interval time.Duration) {
+	defer close(s.refreshDone)
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		s.refreshLeaderboard()
+	for {
+		select {
+		case <-ticker.C:
+			s.refreshLeaderboard()
+		case <-s.stopRefresh:
+			return
+		}
 	}
 }
 
-// refreshLeaderboard goes through all talent scores, and builds a new leaderboard.
-// It also builds a new talentLeaderboardIndex map, which is used to quickly find a talent's rank in the leaderboard.
+// minRolloverWait is the shortest wait between two rollovers, so a clock that doesn't move
+// past the end of the day doesn't rebuild the leaderboards in a loop
+const minRolloverWait = 1 * time.Minute
+
+// untilRollover returns how long until the current day ends, by the storage clock
+func (s *InMemStorage) untilRollover() time.Duration {
+	now := s.now()
+	_, end := WindowDaily.Bounds(now, s.location)
+	return max(end.Sub(now), minRolloverWait)
+}
+
+// startWindowRollover rebuilds the leaderboards when the current day ends, so realtime leaderboards move to the new windows.
+// Weeks and months always end at the end of a day.
+func (s *InMemStorage) startWindowRollover(wait time.Duration) {
+	defer close(s.refreshDone)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			s.refreshLeaderboard()
+			timer.Reset(s.untilRollover())
+		case <-s.stopRefresh:
+			return
+		}
+	}
+}
+
+// refreshLeaderboard goes through all talent scores, and builds new leaderboards.
+// In realtime mode it's only needed when windows roll over or the whole state is replaced,
+// as the leaderboards are kept up to date on every write.
 func (s *InMemStorage) refreshLeaderboard() {
-	newLeaderboard := make([]TalentRank, 0, len(s.talentScores))
+	s.talentScoresMu.RLock()
+	keys := s.maintainedBoardKeys(s.currentSeason.ID, s.now())
+	entries := make(map[boardKey][]TalentRank, len(keys))
+	for _, key := range keys {
+		entries[key] = s.leaderboardEntries(key)
+	}
+
+	newLeaderboards := make(map[boardKey]leaderboard, len(keys))
+	if s.leaderboardMode == LeaderboardModeRealtime {
+		// Keep holding talentScoresMu, so no SaveTalentScore call is missed while the skiplists are built
+		defer s.talentScoresMu.RUnlock()
+		for _, key := range keys {
+			newLeaderboards[key] = newSkiplistLeaderboard(entries[key], s.rankMode)
+		}
+	} else {
+		s.talentScoresMu.RUnlock()
+		for _, key := range keys {
+			newLeaderboards[key] = newSortedLeaderboard(entries[key], s.rankMode)
+		}
+	}
+
+	s.leaderboardMu.Lock()
+	s.leaderboards = newLeaderboards
+	s.leaderboardMu.Unlock()
+}
+
+// CloseSeason archives the final standings of the current season and starts a new one
+func (s *InMemStorage) CloseSeason(ctx context.Context) (Season, error) {
+	return s.closeSeason(s.now(), s.rankMode), nil
+}
+
+// closeSeason ends the current season at the given time and ranks its standings with the given mode.
+// The standings are built from the talent scores rather than copied from the leaderboards,
+// so they're exact even in periodic mode.
+func (s *InMemStorage) closeSeason(at time.Time, mode RankMode) Season {
+	s.talentScoresMu.Lock()
+
+	season := s.currentSeason
+	season.EndedAt = at
+
+	archived := &archivedSeason{
+		Season:       season,
+		leaderboards: make(map[Skill]*sortedLeaderboard),
+	}
+	for _, skill := range leaderboardSkills {
+		key := boardKey{season: season.ID, skill: skill, window: WindowAllTime}
+		archived.leaderboards[skill] = newSortedLeaderboard(s.leaderboardEntries(key), mode)
+	}
+
+	s.archivedSeasons[season.ID] = archived
+	s.currentSeason = Season{ID: season.ID + 1, StartedAt: at}
+	s.talentScoresMu.Unlock()
 
+	// Until the refresh is done, reads of the new season are served by leaderboards built on the fly
+	s.refreshLeaderboard()
+
+	return season
+}
+
+// GetTalentProfile summarizes the scores of all seasons, while the rank is the one in the current season
+func (s *InMemStorage) GetTalentProfile(ctx context.Context, talentID TalentID) (TalentProfile, bool, error) {
 	s.talentScoresMu.RLock()
-	for _, scores := range s.talentScores {
-		var bestTalentScore TalentScore
-		for _, score := range scores {
-			if score.Score > bestTalentScore.Score {
-				bestTalentScore = score
+	scores := s.talentScores[talentID]
+	profile := TalentProfile{
+		TalentID:   talentID,
+		ScoreCount: len(scores),
+		Bests:      bestScorePerSkill(scores),
+	}
+	for _, score := range scores {
+		if score.Timestamp.IsZero() {
+			continue
+		}
+		if profile.FirstActivityAt.IsZero() || score.Timestamp.Before(profile.FirstActivityAt) {
+			profile.FirstActivityAt = score.Timestamp
+		}
+		if score.Timestamp.After(profile.LastActivityAt) {
+			profile.LastActivityAt = score.Timestamp
+		}
+	}
+	s.talentScoresMu.RUnlock()
+
+	if len(scores) == 0 {
+		return TalentProfile{}, false, nil
+	}
+
+	rank, found, err := s.FindTalentRank(ctx, LeaderboardKey{}, talentID)
+	if err != nil {
+		return TalentProfile{}, false, err
+	}
+	if found {
+		profile.Rank = rank.Rank
+	}
+	return profile, true, nil
+}
+
+func (s *InMemStorage) RecordRanks(ctx context.Context) error {
+	s.recordRanks(s.now())
+	return nil
+}
+
+// recordRanks adds a point to the rank history of every talent whose rank or score changed since its last point.
+func (s *InMemStorage) recordRanks(at time.Time) {
+	s.recordRanksMu.Lock()
+	defer s.recordRanksMu.Unlock()
+
+	s.addRankPoints(at, s.rankPoints(at))
+}
+
+// rankPoints returns the new rank history points of the talents whose rank or score changed since their last point,
+// by skill. Ranks are computed from the talent scores rather than read from the leaderboards, so they're exact
+// in periodic mode. The leaderboards are sorted from a copy of the entries, so writes aren't blocked meanwhile.
+// The caller must hold recordRanksMu, so the history doesn't change until the points are added.
+func (s *InMemStorage) rankPoints(at time.Time) map[Skill]map[TalentID]RankHistoryPoint {
+	s.talentScoresMu.RLock()
+	season := s.currentSeason.ID
+	entries := make(map[Skill][]TalentRank, len(leaderboardSkills))
+	for _, skill := range leaderboardSkills {
+		entries[skill] = s.leaderboardEntries(boardKey{season: season, skill: skill, window: WindowAllTime})
+	}
+	s.talentScoresMu.RUnlock()
+
+	boards := make(map[Skill]*sortedLeaderboard, len(entries))
+	for skill, skillEntries := range entries {
+		boards[skill] = newSortedLeaderboard(skillEntries, s.rankMode)
+	}
+
+	s.talentScoresMu.RLock()
+	defer s.talentScoresMu.RUnlock()
+
+	points := make(map[Skill]map[TalentID]RankHistoryPoint, len(boards))
+	for skill, board := range boards {
+		skillPoints := make(map[TalentID]RankHistoryPoint)
+		history := s.rankHistory[skill]
+		for _, entry := range board.ranks {
+			if talentPoints := history[entry.TalentID]; len(talentPoints) > 0 {
+				last := talentPoints[len(talentPoints)-1]
+				if last.Season == season && last.Rank == entry.Rank && last.Score == entry.TalentScore.Score {
+					continue
+				}
+			}
+			skillPoints[entry.TalentID] = RankHistoryPoint{
+				At:     at,
+				Season: season,
+				Rank:   entry.Rank,
+				Score:  entry.TalentScore.Score,
 			}
 		}
+		points[skill] = skillPoints
+	}
+	return points
+}
 
-		if bestTalentScore.Score == 0 {
-			continue
+// addRankPoints appends the points to the rank history and drops the points older than the retention.
+// Points of a season that was closed since they were computed are dropped, as the talents' ranks have changed.
+func (s *InMemStorage) addRankPoints(at time.Time, points map[Skill]map[TalentID]RankHistoryPoint) {
+	s.talentScoresMu.Lock()
+	defer s.talentScoresMu.Unlock()
+
+	for skill, skillPoints := range points {
+		history, ok := s.rankHistory[skill]
+		if !ok {
+			history = make(map[TalentID][]RankHistoryPoint)
+			s.rankHistory[skill] = history
+		}
+		for talentID, point := range skillPoints {
+			if point.Season == s.currentSeason.ID {
+				history[talentID] = append(history[talentID], point)
+			}
+		}
+	}
+	if s.rankHistoryRetention > 0 {
+		for _, history := range s.rankHistory {
+			pruneRankHistory(history, at.Add(-s.rankHistoryRetention))
 		}
-		newLeaderboard = append(newLeaderboard, TalentRank{
-			TalentID:    bestTalentScore.TalentID,
-			TalentScore: bestTalentScore,
-			Rank:        len(newLeaderboard) + 1,
+	}
+}
+
+// pruneRankHistory drops the points recorded before cutoff. The last point of a talent is kept,
+// as it's the previous rank of the talent until its rank changes again.
+func pruneRankHistory(history map[TalentID][]RankHistoryPoint, cutoff time.Time) {
+	for talentID, points := range history {
+		keep := sort.Search(len(points)-1, func(i int) bool {
+			return !points[i].At.Before(cutoff)
 		})
+		if keep > 0 {
+			history[talentID] = append([]RankHistoryPoint(nil), points[keep:]...)
+		}
 	}
+}
+
+func (s *InMemStorage) FindPreviousRank(ctx context.Context, key LeaderboardKey, talentID TalentID) (RankHistoryPoint, bool, error) {
+	s.talentScoresMu.RLock()
+	defer s.talentScoresMu.RUnlock()
+
+	if key.Window != "" && key.Window != WindowAllTime {
+		return RankHistoryPoint{}, false, nil
+	}
+	if key.Season != 0 && key.Season != s.currentSeason.ID {
+		return RankHistoryPoint{}, false, nil
+	}
+
+	points := s.rankHistory[key.Skill][talentID]
+	if len(points) == 0 || points[len(points)-1].Season != s.currentSeason.ID {
+		return RankHistoryPoint{}, false, nil
+	}
+	return points[len(points)-1], true, nil
+}
+
+func (s *InMemStorage) GetRankHistory(ctx context.Context, skill Skill, talentID TalentID, from, to time.Time) ([]RankHistoryPoint, error) {
+	s.talentScoresMu.RLock()
+	defer s.talentScoresMu.RUnlock()
+
+	points := []RankHistoryPoint{}
+	for _, point := range s.rankHistory[skill][talentID] {
+		if !from.IsZero() && point.At.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !point.At.Before(to) {
+			break
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// GetSeasons returns the archived seasons and the current one, ordered by ID
+func (s *InMemStorage) GetSeasons(ctx context.Context) ([]Season, error) {
+	s.talentScoresMu.RLock()
+	defer s.talentScoresMu.RUnlock()
+
+	seasons := make([]Season, 0, len(s.archivedSeasons)+1)
+	for id := 1; id < s.currentSeason.ID; id++ {
+		if archived, ok := s.archivedSeasons[id]; ok {
+			seasons = append(seasons, archived.Season)
+		}
+	}
+	return append(seasons, s.currentSeason), nil
+}
+
+// leaderboardEntries returns the unsorted entries of all talents in the leaderboard.
+// It must be called with talentScoresMu held.
+func (s *InMemStorage) leaderboardEntries(key boardKey) []TalentRank {
+	entries := make([]TalentRank, 0, len(s.talentScores))
+	for _, scores := range s.talentScores {
+		if entry, ok := s.talentRankEntry(scores, key); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// talentRankEntry returns the entry of a talent in the leaderboard, which is the aggregate of the scores the leaderboard includes.
+// Returns false if the talent has no positive aggregated score in it.
+func (s *InMemStorage) talentRankEntry(scores []TalentScore, key boardKey) (TalentRank, bool) {
+	included := make([]TalentScore, 0, len(scores))
+	for _, score := range scores {
+		if key.includes(score) {
+			included = append(included, score)
+		}
+	}
+
+	talentScore, ok := s.aggregator.Aggregate(included)
+	if !ok || talentScore.Score <= 0 {
+		return TalentRank{}, false
+	}
+	return TalentRank{
+		TalentID:    talentScore.TalentID,
+		TalentScore: talentScore,
+	}, true
+}
+
+// storageState is a point-in-time copy of the storage, used for snapshots.
+type storageState struct {
+	// EventFingerprints is the map of every event ID ever saved to the fingerprint of its payload,
+	// including the IDs of purged events, so reusing them with another payload is still a conflict
+	EventFingerprints map[string]string `json:"event_fingerprints"`
+	// EventIDs is the list of saved event IDs of snapshots taken before EventFingerprints existed
+	EventIDs []string `json:"event_ids,omitempty"`
+	// ScoreEvents is the list of all score events with their processing state, in the order of insertion
+	ScoreEvents []ScoreEventStatus `json:"score_events"`
+	// Outbox is the list of unprocessed score events of snapshots taken before ScoreEvents existed.
+	// Their processed events weren't kept, only the IDs for deduplication.
+	Outbox          []ScoreEvent               `json:"outbox,omitempty"`
+	TalentScores    map[TalentID][]TalentScore `json:"talent_scores"`
+	CurrentSeason   Season                     `json:"current_season"`
+	ArchivedSeasons []archivedSeasonState      `json:"archived_seasons"`
+	// RankHistory is the rank history by skill and talent
+	RankHistory map[Skill]map[TalentID][]RankHistoryPoint `json:"rank_history,omitempty"`
+}
+
+// archivedSeasonState is the final standings of an archived season by skill, the global leaderboard has the empty skill
+type archivedSeasonState struct {
+	Season    Season                 `json:"season"`
+	Standings map[Skill][]TalentRank `json:"standings"`
+}
+
+// exportState returns a deep copy of the current state
+func (s *InMemStorage) exportState() storageState {
+	state := storageState{
+		TalentScores: make(map[TalentID][]TalentScore),
+	}
+
+	s.scoreEventsMu.RLock()
+	state.EventFingerprints = maps.Clone(s.eventFingerprints)
+	state.ScoreEvents = make([]ScoreEventStatus, len(s.scoreEvents))
+	for i, status := range s.scoreEvents {
+		state.ScoreEvents[i] = *status
+	}
+	s.scoreEventsMu.RUnlock()
+
+	s.talentScoresMu.RLock()
+	for talentID, scores := range s.talentScores {
+		state.TalentScores[talentID] = append([]TalentScore(nil), scores...)
+	}
+	state.CurrentSeason = s.currentSeason
+	for id := 1; id < s.currentSeason.ID; id++ {
+		archived, ok := s.archivedSeasons[id]
+		if !ok {
+			continue
+		}
+		seasonState := archivedSeasonState{Season: archived.Season, Standings: make(map[Skill][]TalentRank)}
+		for skill, board := range archived.leaderboards {
+			seasonState.Standings[skill] = board.ranks
+		}
+		state.ArchivedSeasons = append(state.ArchivedSeasons, seasonState)
+	}
+	state.RankHistory = copyRankHistory(s.rankHistory)
 	s.talentScoresMu.RUnlock()
 
-	// Sort by score in descending order (highest score at index 0)
-	sort.Slice(newLeaderboard, func(i, j int) bool {
-		return newLeaderboard[i].TalentScore.Score > newLeaderboard[j].TalentScore.Score
-	})
+	return state
+}
 
-	newTalentLeaderboardIndex := make(map[TalentID]int)
+// importState replaces the current state with the given one and rebuilds the leaderboard
+func (s *InMemStorage) importState(state storageState) {
+	eventFingerprints := make(map[string]string, len(state.EventFingerprints)+len(state.EventIDs))
+	for _, eventID := range state.EventIDs {
+		eventFingerprints[eventID] = ""
+	}
+	maps.Copy(eventFingerprints, state.EventFingerprints)
+	talentScores := make(map[TalentID][]TalentScore, len(state.TalentScores))
+	for talentID, scores := range state.TalentScores {
+		talentScores[talentID] = append([]TalentScore(nil), scores...)
+	}
+
+	scoreEvents := make([]*ScoreEventStatus, 0, len(state.ScoreEvents)+len(state.Outbox))
+	for _, status := range state.ScoreEvents {
+		status.TalentScore = nil
+		// Leases aren't kept, the workers that held them are gone after a restart
+		releaseLease(&status)
+		scoreEvents = append(scoreEvents, &status)
+	}
+	for _, event := range state.Outbox {
+		scoreEvents = append(scoreEvents, &ScoreEventStatus{Event: event, State: ScoreEventPending})
+	}
+	eventStatuses := make(map[string]*ScoreEventStatus, len(scoreEvents))
+	deadLetters := make(map[string]*ScoreEventStatus)
+	var outbox []*ScoreEventStatus
+	outboxed := make(map[string]struct{})
+	for _, status := range scoreEvents {
+		eventStatuses[status.Event.EventID] = status
+		if status.State == ScoreEventDeadLettered {
+			deadLetters[status.Event.EventID] = status
+		}
+		if consumable(status) {
+			outbox = append(outbox, status)
+			outboxed[status.Event.EventID] = struct{}{}
+		}
+		// Snapshots taken before fingerprints were kept only have the IDs, the fingerprint is of the event
+		// as it was received, before any correction
+		if eventFingerprints[status.Event.EventID] == "" {
+			received := status.Event
+			if len(status.Corrections) > 0 {
+				received = status.Corrections[0].Previous
+			}
+			eventFingerprints[status.Event.EventID] = scoreEventFingerprint(received)
+		}
+	}
 
-	// set the rank field for each item in the leaderboard.
-	// and populate the talentLeaderboardIndex map.
-	for leaderboardIndex, talentRank := range newLeaderboard {
-		talentRank.Rank = leaderboardIndex + 1
-		newLeaderboard[leaderboardIndex] = talentRank
+	s.scoreEventsMu.Lock()
+	s.eventFingerprints = eventFingerprints
+	s.scoreEvents = scoreEvents
+	s.eventStatuses = eventStatuses
+	s.deadLetters = deadLetters
+	s.outbox = outbox
+	s.outboxed = outboxed
+	s.scoreEventsMu.Unlock()
 
-		newTalentLeaderboardIndex[talentRank.TalentID] = leaderboardIndex
+	currentSeason := state.CurrentSeason
+	if currentSeason.ID == 0 {
+		// Snapshots taken before seasons existed
+		currentSeason.ID = 1
+	}
+	archivedSeasons := make(map[int]*archivedSeason, len(state.ArchivedSeasons))
+	for _, seasonState := range state.ArchivedSeasons {
+		archived := &archivedSeason{Season: seasonState.Season, leaderboards: make(map[Skill]*sortedLeaderboard)}
+		for _, skill := range leaderboardSkills {
+			archived.leaderboards[skill] = restoreSortedLeaderboard(append([]TalentRank(nil), seasonState.Standings[skill]...))
+		}
+		archivedSeasons[archived.ID] = archived
 	}
 
-	s.leaderboardMu.Lock()
-	s.leaderboard = newLeaderboard
-	s.talentLeaderboardIndex = newTalentLeaderboardIndex
-	s.leaderboardMu.Unlock()
+	s.talentScoresMu.Lock()
+	s.talentScores = talentScores
+	s.currentSeason = currentSeason
+	s.archivedSeasons = archivedSeasons
+	s.rankHistory = copyRankHistory(state.RankHistory)
+	s.talentScoresMu.Unlock()
+
+	s.refreshLeaderboard()
+}
+
+func copyRankHistory(history map[Skill]map[TalentID][]RankHistoryPoint) map[Skill]map[TalentID][]RankHistoryPoint {
+	copied := make(map[Skill]map[TalentID][]RankHistoryPoint, len(history))
+	for skill, talents := range history {
+		copied[skill] = make(map[TalentID][]RankHistoryPoint, len(talents))
+		for talentID, points := range talents {
+			copied[skill][talentID] = append([]RankHistoryPoint(nil), points...)
+		}
+	}
+	return copied
 }
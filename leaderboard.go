@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// LeaderboardMode defines how the storage keeps the leaderboard up to date.
+type LeaderboardMode string
+
+const (
+	// LeaderboardModePeriodic rebuilds and re-sorts the whole leaderboard every refresh interval.
+	// Writes are cheap, but ranks can be up to one interval stale.
+	LeaderboardModePeriodic LeaderboardMode = "periodic"
+	// LeaderboardModeRealtime keeps talents in a skiplist that's updated on every saved talent score,
+	// so ranks are always exact, at the cost of O(log n) work per write.
+	LeaderboardModeRealtime LeaderboardMode = "realtime"
+)
+
+func ParseLeaderboardMode(s string) (LeaderboardMode, error) {
+	switch mode := LeaderboardMode(s); mode {
+	case LeaderboardModePeriodic, LeaderboardModeRealtime:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown leaderboard mode %q, must be one of: periodic, realtime", s)
+}
+
+// RankMode defines how tied talents are ranked. Tied talents are always listed in the tie-break order,
+// the mode only decides the rank numbers they get.
+type RankMode string
+
+const (
+	// RankModeOrdinal gives every talent a distinct rank: 1, 2, 3, 4
+	RankModeOrdinal RankMode = "ordinal"
+	// RankModeCompetition gives tied talents the same rank and leaves a gap after them: 1, 2, 2, 4
+	RankModeCompetition RankMode = "competition"
+	// RankModeDense gives tied talents the same rank without a gap: 1, 2, 2, 3
+	RankModeDense RankMode = "dense"
+)
+
+func ParseRankMode(s string) (RankMode, error) {
+	switch mode := RankMode(s); mode {
+	case RankModeOrdinal, RankModeCompetition, RankModeDense:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown rank mode %q, must be one of: ordinal, competition, dense", s)
+}
+
+// rankFrom sets the Rank of consecutive entries, where the first entry is at the 0-based position offset and has the given rank
+func (m RankMode) rankFrom(entries []TalentRank, offset, rank int) {
+	for i := range entries {
+		if i > 0 {
+			tied := entries[i].TalentScore.Score == entries[i-1].TalentScore.Score
+			switch {
+			case m == RankModeOrdinal, m == RankModeCompetition && !tied:
+				rank = offset + i + 1
+			case m == RankModeDense && !tied:
+				rank++
+			}
+		}
+		entries[i].Rank = rank
+	}
+}
+
+// leaderboard is a ranking of talents, highest score first.
+// Implementations are not safe for concurrent use, the storage guards them with leaderboardMu.
+type leaderboard interface {
+	Len() int
+	// Range returns up to limit talent ranks starting from the 0-based position offset
+	Range(offset, limit int) []TalentRank
+	Find(talentID TalentID) (TalentRank, bool)
+	// Position returns the 0-based position of the talent
+	Position(talentID TalentID) (int, bool)
+	// After returns the 0-based position of the first talent ranked after the cursor
+	After(cursor LeaderboardCursor) int
+}
+
+// exactRank looks up the rank of the talent in the leaderboard
+func exactRank(board leaderboard, talentID TalentID) (RankEstimate, bool) {
+	entry, ok := board.Find(talentID)
+	if !ok {
+		return RankEstimate{}, false
+	}
+	return RankEstimate{
+		TalentID: entry.TalentID,
+		Score:    entry.TalentScore.Score,
+		Rank:     entry.Rank,
+		Total:    board.Len(),
+		Exact:    true,
+	}, true
+}
+
+// estimateRank places the talent's score in a histogram of the unsorted entries, in O(n) without sorting them
+func estimateRank(entries []TalentRank, talentID TalentID) (RankEstimate, bool) {
+	histogram := &scoreHistogram{}
+	var talent *TalentRank
+	for i := range entries {
+		histogram.Add(entries[i].TalentScore.Score, 1)
+		if entries[i].TalentID == talentID {
+			talent = &entries[i]
+		}
+	}
+	if talent == nil {
+		return RankEstimate{}, false
+	}
+	return RankEstimate{
+		TalentID: talent.TalentID,
+		Score:    talent.TalentScore.Score,
+		Rank:     histogram.Above(talent.TalentScore.Score) + 1,
+		Total:    histogram.Total(),
+	}, true
+}
+
+// leaderboardPage returns the requested page and the cursor of the page after it
+func leaderboardPage(board leaderboard, req LeaderboardPageRequest) LeaderboardPage {
+	offset := req.Offset
+	if req.After != nil {
+		offset = board.After(*req.After)
+	}
+
+	page := LeaderboardPage{
+		Talents: board.Range(offset, req.Limit),
+		Total:   board.Len(),
+	}
+	if n := len(page.Talents); n > 0 && offset+n < page.Total {
+		last := page.Talents[n-1]
+		page.Next = &LeaderboardCursor{Score: last.TalentScore.Score, Timestamp: last.TalentScore.Timestamp, TalentID: last.TalentID}
+	}
+	return page
+}
+
+// neighbors returns the talent's entry with up to above talents ranked right before it and up to below talents ranked right after it
+func neighbors(board leaderboard, talentID TalentID, above, below int) ([]TalentRank, bool) {
+	position, ok := board.Position(talentID)
+	if !ok {
+		return nil, false
+	}
+
+	offset := max(position-above, 0)
+	return board.Range(offset, position-offset+1+below), true
+}
+
+// cursorEntry is the leaderboard entry at the place of the cursor, to compare with rankedBefore
+func cursorEntry(cursor LeaderboardCursor) TalentRank {
+	return TalentRank{
+		TalentID:    cursor.TalentID,
+		TalentScore: TalentScore{TalentID: cursor.TalentID, Score: cursor.Score, Timestamp: cursor.Timestamp},
+	}
+}
+
+// rankedBefore is the order of the leaderboard: higher score first, then the talent that achieved it earlier,
+// and talent ID to break the remaining ties, so two talents never swap places between refreshes.
+func rankedBefore(a, b TalentRank) bool {
+	if a.TalentScore.Score != b.TalentScore.Score {
+		return a.TalentScore.Score > b.TalentScore.Score
+	}
+	if !a.TalentScore.Timestamp.Equal(b.TalentScore.Timestamp) {
+		return a.TalentScore.Timestamp.Before(b.TalentScore.Timestamp)
+	}
+	return a.TalentID < b.TalentID
+}
+
+// sortedLeaderboard is an immutable leaderboard built at once from all entries.
+type sortedLeaderboard struct {
+	// ranks is the sorted list of talent ranks, with the Rank field already set
+	ranks []TalentRank
+	// index is the map of talentID to its position in ranks.
+	// Assuming that we'll have more reads than writes, this map provides a fast way of lookup.
+	index map[TalentID]int
+}
+
+func newSortedLeaderboard(entries []TalentRank, mode RankMode) *sortedLeaderboard {
+	sort.Slice(entries, func(i, j int) bool {
+		return rankedBefore(entries[i], entries[j])
+	})
+	mode.rankFrom(entries, 0, 1)
+
+	index := make(map[TalentID]int, len(entries))
+	for i := range entries {
+		index[entries[i].TalentID] = i
+	}
+
+	return &sortedLeaderboard{ranks: entries, index: index}
+}
+
+// restoreSortedLeaderboard builds a leaderboard from ranks that are already sorted and ranked, like the standings
+// of an archived season, so they're kept as they were even if the rank mode has changed since
+func restoreSortedLeaderboard(ranks []TalentRank) *sortedLeaderboard {
+	index := make(map[TalentID]int, len(ranks))
+	for i := range ranks {
+		index[ranks[i].TalentID] = i
+	}
+
+	return &sortedLeaderboard{ranks: ranks, index: index}
+}
+
+func (l *sortedLeaderboard) Len() int {
+	return len(l.ranks)
+}
+
+func (l *sortedLeaderboard) Range(offset, limit int) []TalentRank {
+	if offset >= len(l.ranks) {
+		return []TalentRank{}
+	}
+	end := min(offset+limit, len(l.ranks))
+
+	ranks := make([]TalentRank, end-offset)
+	copy(ranks, l.ranks[offset:end])
+	return ranks
+}
+
+func (l *sortedLeaderboard) Position(talentID TalentID) (int, bool) {
+	i, ok := l.index[talentID]
+	return i, ok
+}
+
+func (l *sortedLeaderboard) After(cursor LeaderboardCursor) int {
+	entry := cursorEntry(cursor)
+	return sort.Search(len(l.ranks), func(i int) bool {
+		return rankedBefore(entry, l.ranks[i])
+	})
+}
+
+func (l *sortedLeaderboard) Find(talentID TalentID) (TalentRank, bool) {
+	i, ok := l.index[talentID]
+	if !ok {
+		return TalentRank{}, false
+	}
+	return l.ranks[i], true
+}
+
+// skiplistLeaderboard is a mutable leaderboard, where every talent's position is updated in O(log n).
+type skiplistLeaderboard struct {
+	list *skiplist[TalentRank]
+	// entries holds the current entry of each talent, which is needed to find it in the list
+	entries map[TalentID]TalentRank
+
+	mode RankMode
+	// scores is the set of distinct scores, highest first, with the number of talents that have each.
+	// The dense rank of a score is its position in this list.
+	scores      *skiplist[int]
+	scoreCounts map[int]int
+}
+
+func newSkiplistLeaderboard(entries []TalentRank, mode RankMode) *skiplistLeaderboard {
+	l := &skiplistLeaderboard{
+		list:        newSkiplist(rankedBefore),
+		entries:     make(map[TalentID]TalentRank, len(entries)),
+		mode:        mode,
+		scores:      newSkiplist(func(a, b int) bool { return a > b }),
+		scoreCounts: make(map[int]int),
+	}
+	for _, entry := range entries {
+		l.Upsert(entry)
+	}
+	return l
+}
+
+// Upsert inserts the talent or moves it to the position of its new score
+func (l *skiplistLeaderboard) Upsert(entry TalentRank) {
+	l.Remove(entry.TalentID)
+
+	entry.Rank = 0
+	l.entries[entry.TalentID] = entry
+	l.list.Insert(entry)
+
+	score := entry.TalentScore.Score
+	if l.scoreCounts[score] == 0 {
+		l.scores.Insert(score)
+	}
+	l.scoreCounts[score]++
+}
+
+// Remove takes the talent out of the leaderboard
+func (l *skiplistLeaderboard) Remove(talentID TalentID) {
+	current, ok := l.entries[talentID]
+	if !ok {
+		return
+	}
+	l.list.Delete(current)
+	delete(l.entries, talentID)
+
+	score := current.TalentScore.Score
+	l.scoreCounts[score]--
+	if l.scoreCounts[score] == 0 {
+		delete(l.scoreCounts, score)
+		l.scores.Delete(score)
+	}
+}
+
+// rankAt returns the rank of the entry at the 0-based position
+func (l *skiplistLeaderboard) rankAt(position int, entry TalentRank) int {
+	switch l.mode {
+	case RankModeCompetition:
+		// The position of the first talent with the same score. The zero timestamp and the empty talent ID
+		// place the probe before every real talent with that score.
+		probe := TalentRank{TalentScore: TalentScore{Score: entry.TalentScore.Score}}
+		return l.list.LowerBound(probe) + 1
+	case RankModeDense:
+		return l.scores.LowerBound(entry.TalentScore.Score) + 1
+	}
+	return position + 1
+}
+
+func (l *skiplistLeaderboard) Len() int {
+	return l.list.Len()
+}
+
+func (l *skiplistLeaderboard) Range(offset, limit int) []TalentRank {
+	ranks := l.list.Range(offset, limit)
+	if ranks == nil {
+		return []TalentRank{}
+	}
+	l.mode.rankFrom(ranks, offset, l.rankAt(offset, ranks[0]))
+	return ranks
+}
+
+func (l *skiplistLeaderboard) Position(talentID TalentID) (int, bool) {
+	entry, ok := l.entries[talentID]
+	if !ok {
+		return 0, false
+	}
+	return l.list.LowerBound(entry), true
+}
+
+func (l *skiplistLeaderboard) After(cursor LeaderboardCursor) int {
+	return l.list.UpperBound(cursorEntry(cursor))
+}
+
+func (l *skiplistLeaderboard) Find(talentID TalentID) (TalentRank, bool) {
+	entry, ok := l.entries[talentID]
+	if !ok {
+		return TalentRank{}, false
+	}
+	entry.Rank = l.rankAt(l.list.LowerBound(entry), entry)
+	return entry, true
+}
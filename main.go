@@ -13,14 +13,29 @@ import (
 )
 
 func main() {
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Create storage and scorer
-	storage := NewInMemStorage(1 * time.Second) // Refresh leaderboard every second
+	storage, closeStorage, err := newStorage(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create storage: %v", err)
+	}
 	scorer := NewWeightBasedScorer(map[Skill]int{
 		SkillDribble: 1,
 		SkillShoot:   2,
 		SkillPass:    3,
 	})
-	service := NewService(storage, scorer)
+	service := NewServiceWithOptions(storage, scorer, ServiceOptions{Workers: cfg.Workers, WorkerID: cfg.WorkerID})
 
 	// Start the background job to process score events
 	ctx, cancel := context.WithCancel(context.Background())
@@ -36,7 +51,24 @@ func main() {
 		log.Println("ProcessScoreEvents stopped")
 	}()
 
-	handler := NewHTTPHandler(service)
+	if cfg.RankHistoryInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service.RecordRankHistory(ctx, cfg.RankHistoryInterval)
+		}()
+	}
+
+	if cfg.AdminToken == "" && !cfg.AdminOpen {
+		log.Println("Admin endpoints are disabled, set CUJU_ADMIN_TOKEN to enable them")
+	}
+	handler := NewHTTPHandler(service, HTTPOptions{
+		Location:       cfg.Location,
+		AdminToken:     cfg.AdminToken,
+		AdminOpen:      cfg.AdminOpen,
+		ExactRankLimit: cfg.ExactRankLimit,
+		Validation:     cfg.Validation,
+	})
 	mux := handler.SetupRoutes()
 
 	// Setup metrics server
@@ -90,5 +122,64 @@ func main() {
 	}
 
 	wg.Wait()
+
+	if err := closeStorage(); err != nil {
+		log.Printf("Failed to close storage: %v", err)
+	}
 	log.Println("Exiting...")
 }
+
+// newStorage creates the storage selected in the config, and returns a func to release it on shutdown
+func newStorage(cfg Config) (Storage, func() error, error) {
+	switch cfg.StorageType {
+	case StorageTypeFile:
+		storage, err := openFileStorage(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return storage, storage.Close, nil
+	default:
+		inMemOpts, err := inMemStorageOptions(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		storage := NewInMemStorageWithOptions(inMemOpts)
+		return storage, storage.Close, nil
+	}
+}
+
+func openFileStorage(cfg Config) (*FileStorage, error) {
+	inMemOpts, err := inMemStorageOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFileStorage(cfg.DataDir, FileStorageOptions{
+		InMem: inMemOpts,
+		WAL: WALOptions{
+			SyncPolicy:   cfg.SyncPolicy,
+			SyncInterval: cfg.SyncInterval,
+		},
+		SnapshotInterval: cfg.SnapshotInterval,
+		SnapshotRetain:   cfg.SnapshotRetain,
+	})
+}
+
+func inMemStorageOptions(cfg Config) (InMemStorageOptions, error) {
+	aggregator, err := NewAggregator(cfg.Aggregation)
+	if err != nil {
+		return InMemStorageOptions{}, err
+	}
+
+	return InMemStorageOptions{
+		LeaderboardMode:      cfg.LeaderboardMode,
+		RankMode:             cfg.RankMode,
+		RefreshInterval:      1 * time.Second, // Refresh leaderboard every second
+		Aggregator:           aggregator,
+		Location:             cfg.Location,
+		MaxAttempts:          cfg.MaxAttempts,
+		Retry:                cfg.Retry,
+		LeaseTimeout:         cfg.LeaseTimeout,
+		RankHistoryRetention: cfg.RankHistoryRetention,
+	}, nil
+}
@@ -10,6 +10,12 @@ import (
 var (
 	ScoreEventsTotal      uint64
 	ScoreEventsDuplicates uint64
+	// ScoreEventsConflicts counts events that reused the ID of a different event
+	ScoreEventsConflicts uint64
+	// ScoreEventsRetried counts failed attempts after which the event is retried
+	ScoreEventsRetried uint64
+	// ScoreEventsDeadLettered counts events that were dead-lettered after their last attempt
+	ScoreEventsDeadLettered uint64
 )
 
 type MetricsServer struct{}
@@ -24,10 +30,16 @@ func (m *MetricsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	total := atomic.LoadUint64(&ScoreEventsTotal)
 	duplicates := atomic.LoadUint64(&ScoreEventsDuplicates)
+	conflicts := atomic.LoadUint64(&ScoreEventsConflicts)
+	retried := atomic.LoadUint64(&ScoreEventsRetried)
+	deadLettered := atomic.LoadUint64(&ScoreEventsDeadLettered)
 	timestamp := time.Now().UnixMilli()
 
 	fmt.Fprintf(w, "score_events_total %d %d\n", total, timestamp)
 	fmt.Fprintf(w, "score_events_duplicate %d %d\n", duplicates, timestamp)
+	fmt.Fprintf(w, "score_events_conflict %d %d\n", conflicts, timestamp)
+	fmt.Fprintf(w, "score_events_retried %d %d\n", retried, timestamp)
+	fmt.Fprintf(w, "score_events_dead_lettered %d %d\n", deadLettered, timestamp)
 }
 
 func (m *MetricsServer) SetupRoutes() http.Handler {
@@ -44,6 +56,18 @@ func IncScoreEventsDuplicate() {
 	atomic.AddUint64(&ScoreEventsDuplicates, 1)
 }
 
+func IncScoreEventsConflict() {
+	atomic.AddUint64(&ScoreEventsConflicts, 1)
+}
+
+func IncScoreEventsRetried() {
+	atomic.AddUint64(&ScoreEventsRetried, 1)
+}
+
+func IncScoreEventsDeadLettered() {
+	atomic.AddUint64(&ScoreEventsDeadLettered, 1)
+}
+
 func GetGlobalMetrics() *MetricsServer {
 	return &MetricsServer{}
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy is the exponential backoff of failed score events.
+// The zero value retries a failed event right away, on the next poll.
+type RetryPolicy struct {
+	// BaseDelay is the delay after the first failed attempt
+	BaseDelay time.Duration
+	// Multiplier is how much the delay grows with each failed attempt (default is 2)
+	Multiplier float64
+	// MaxDelay caps the delay, zero means no cap
+	MaxDelay time.Duration
+	// Jitter is the fraction of the delay, between 0 and 1, that is randomly taken off it,
+	// so events that failed together during an outage don't all hit the scorer again at the same time
+	Jitter float64
+}
+
+// Delay returns how long to wait before the next attempt, after the given number of failed attempts
+func (p RetryPolicy) Delay(failedAttempts int) time.Duration {
+	return p.delay(failedAttempts, rand.Float64())
+}
+
+// delay is Delay with the random number in [0, 1) to take the jitter with
+func (p RetryPolicy) delay(failedAttempts int, random float64) time.Duration {
+	if p.BaseDelay <= 0 || failedAttempts <= 0 {
+		return 0
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	delay := float64(p.BaseDelay)
+	for i := 1; i < failedAttempts; i++ {
+		delay *= multiplier
+		// Stop growing once over the cap, which also keeps the delay from overflowing
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	delay -= delay * p.Jitter * random
+	return time.Duration(delay)
+}
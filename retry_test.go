@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("delay grows exponentially up to the max delay", func(t *testing.T) {
+		policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+		var delays []time.Duration
+		for attempts := 1; attempts <= 6; attempts++ {
+			delays = append(delays, policy.delay(attempts, 0))
+		}
+		assert.Equal(t, []time.Duration{
+			1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+		}, delays)
+		assert.Equal(t, 10*time.Second, policy.delay(1000, 0))
+	})
+
+	t.Run("jitter takes up to its fraction off the delay", func(t *testing.T) {
+		policy := RetryPolicy{BaseDelay: time.Second, Multiplier: 3, Jitter: 0.5}
+
+		assert.Equal(t, 9*time.Second, policy.delay(3, 0))
+		assert.Equal(t, 6750*time.Millisecond, policy.delay(3, 0.5))
+		for range 100 {
+			delay := policy.Delay(3)
+			assert.GreaterOrEqual(t, delay, 4500*time.Millisecond)
+			assert.LessOrEqual(t, delay, 9*time.Second)
+		}
+	})
+
+	t.Run("zero policy retries right away", func(t *testing.T) {
+		assert.Zero(t, RetryPolicy{}.Delay(3))
+	})
+}
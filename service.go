@@ -3,12 +3,28 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"math"
+	"os"
+	"sync"
 	"time"
 )
 
 var ErrTalentNotFound = errors.New("talent not found")
 var ErrDuplicateScoreEvent = errors.New("duplicate score event")
+var ErrSeasonNotFound = errors.New("season not found")
+var ErrScoreEventNotFound = errors.New("score event not found")
+
+// ErrLeaseNotHeld is returned when a worker reports the outcome of an event that isn't leased to it,
+// because another worker claimed it after its lease expired, or it was never claimed by the worker
+var ErrLeaseNotHeld = errors.New("lease not held")
+
+// ErrScoreEventRetracted is returned when changing an event that was already retracted
+var ErrScoreEventRetracted = errors.New("score event is retracted")
+
+// ErrScoreEventConflict is returned when an event reuses the ID of a stored event with a different payload
+var ErrScoreEventConflict = errors.New("event ID is already used by a different event")
 
 type TalentID string
 
@@ -20,6 +36,18 @@ const (
 	SkillPass    Skill = "pass"
 )
 
+// Skills is the list of all known skills
+var Skills = []Skill{SkillDribble, SkillShoot, SkillPass}
+
+func (s Skill) IsValid() bool {
+	for _, skill := range Skills {
+		if s == skill {
+			return true
+		}
+	}
+	return false
+}
+
 type ScoreEvent struct {
 	EventID     string
 	TalentID    TalentID
@@ -28,6 +56,70 @@ type ScoreEvent struct {
 	Timestamp   time.Time
 }
 
+// ScoreEventState is the stage of a score event's processing
+type ScoreEventState string
+
+const (
+	// ScoreEventPending is waiting for its first processing attempt
+	ScoreEventPending ScoreEventState = "pending"
+	// ScoreEventProcessed has its TalentScore saved
+	ScoreEventProcessed ScoreEventState = "processed"
+	// ScoreEventFailed failed its last processing attempt and will be retried
+	ScoreEventFailed ScoreEventState = "failed"
+	// ScoreEventRetracted was withdrawn by an admin, it's not processed and its TalentScore is removed
+	ScoreEventRetracted ScoreEventState = "retracted"
+	// ScoreEventDeadLettered failed the maximum number of attempts, it's not retried until an admin requeues it
+	ScoreEventDeadLettered ScoreEventState = "dead_lettered"
+)
+
+// ScoreEventStatus is a stored score event and where it is in its processing
+type ScoreEventStatus struct {
+	Event ScoreEvent
+	State ScoreEventState
+	// Attempts is the number of processing attempts, failed or not
+	Attempts int
+	// LastError is the error of the last failed attempt
+	LastError string
+	// NextAttemptAt is when a failed event is due for its next attempt, zero if it's due right away
+	NextAttemptAt time.Time
+	// DeadLetteredAt is when the event was dead-lettered, zero if it's not dead-lettered
+	DeadLetteredAt time.Time
+	// LeasedBy is the worker that claimed the event last, and LeaseExpiresAt is when its lease expires.
+	// They're cleared when the worker reports the outcome of the event.
+	LeasedBy       string
+	LeaseExpiresAt time.Time
+	// TalentScore is the score calculated from the event, only set for processed events
+	TalentScore *TalentScore
+	// Corrections is the audit trail of the changes made to the event after it was saved, oldest first
+	Corrections []EventCorrection
+}
+
+// CorrectionAction is the kind of change made to a stored score event
+type CorrectionAction string
+
+const (
+	// CorrectionRetract withdraws the event and removes its TalentScore
+	CorrectionRetract CorrectionAction = "retract"
+	// CorrectionCorrect replaces the payload of the event and its TalentScore
+	CorrectionCorrect CorrectionAction = "correct"
+)
+
+// EventCorrection is the audit record of a change made to a stored score event
+type EventCorrection struct {
+	EventID string
+	Action  CorrectionAction
+	Reason  string
+	At      time.Time
+	// Previous is the event before the change
+	Previous ScoreEvent
+	// Corrected is the event after the change, nil for a retraction
+	Corrected *ScoreEvent
+	// PreviousScore is the removed TalentScore, nil if the event wasn't scored yet
+	PreviousScore *TalentScore
+	// Score is the TalentScore of the corrected event, nil for a retraction
+	Score *TalentScore
+}
+
 // TalentScore is a score calculated for a talent for a specific skill.
 type TalentScore struct {
 	TalentID TalentID
@@ -36,6 +128,19 @@ type TalentScore struct {
 
 	// EventID is reference to the ScoreEvent ID that was used to calculate the score
 	EventID string
+	// Timestamp is the time of the ScoreEvent, it decides which time windows the score counts in
+	Timestamp time.Time
+	// Season is the ID of the season the score was saved in, it's set by the storage
+	Season int
+}
+
+// Season is a competition period. Leaderboards only rank the scores of the current season,
+// and once a season is closed, its final standings are archived.
+type Season struct {
+	ID        int
+	StartedAt time.Time
+	// EndedAt is zero for the current season
+	EndedAt time.Time
 }
 
 // TalentRank shows Talent's rank in the leaderboard, specific TalentScore that determined this ranking.
@@ -46,19 +151,188 @@ type TalentRank struct {
 	Rank int
 }
 
+// RankEstimate is the place of a talent in a leaderboard. Unless it's exact, it's derived from the distribution
+// of scores instead of the exact order of talents.
+type RankEstimate struct {
+	TalentID TalentID
+	Score    int
+	// Rank is one more than the number of talents with a better score, give or take the ones with a score close to it
+	// if the rank isn't exact
+	Rank int
+	// Total is the number of talents in the leaderboard
+	Total int
+	// Exact reports whether Rank is the exact rank
+	Exact bool
+}
+
+// Percentile is the percentage of talents ranked at or above the talent, e.g. 3 for the top 3%
+func (e RankEstimate) Percentile() float64 {
+	return percentile(e.Rank, e.Total)
+}
+
+// percentile is the percentage of talents ranked at or above rank, rounded up to two decimals
+func percentile(rank, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Ceil(float64(rank)*100*100/float64(total)) / 100
+}
+
+// TalentProfile is the summary of all scores of a talent
+type TalentProfile struct {
+	TalentID   TalentID
+	ScoreCount int
+	// FirstActivityAt and LastActivityAt are the earliest and latest event times of the talent's scores
+	FirstActivityAt time.Time
+	LastActivityAt  time.Time
+	// Bests is the best score of each skill the talent has a score in. Its EventID is the event behind it.
+	Bests map[Skill]TalentScore
+	// Rank is the talent's rank in the global leaderboard of the current season, zero if it's not ranked
+	Rank int
+}
+
+// RankHistoryPoint is a talent's rank and score in an all-time leaderboard at the time ranks were recorded.
+// A point is only recorded when the rank or the score changed, so the talent kept it until the next point.
+type RankHistoryPoint struct {
+	At     time.Time
+	Season int
+	Rank   int
+	Score  int
+}
+
+// LeaderboardKey identifies a leaderboard. The zero value is the global leaderboard.
+type LeaderboardKey struct {
+	// Skill limits the leaderboard to the scores of a single skill. Empty means all skills.
+	Skill Skill
+	// Window limits the leaderboard to the scores of events in a calendar window. Empty means all-time.
+	Window Window
+	// At picks the window that contains this time. Zero means the current window.
+	At time.Time
+	// Season picks the final standings of an archived season, where Window and At don't apply.
+	// Zero means the current season.
+	Season int
+}
+
+// LeaderboardPageRequest selects a page of a leaderboard, either by position or by the cursor of the previous page
+type LeaderboardPageRequest struct {
+	// Offset is the 0-based position of the first talent of the page. Ignored if After is set.
+	Offset int
+	// After starts the page right after the talent the previous page ended with
+	After *LeaderboardCursor
+	Limit int
+}
+
+// LeaderboardCursor is the place of a talent in the leaderboard order.
+// Unlike an offset, it stays valid when the leaderboard changes between two page reads:
+// the next page starts right after it, even if talents have moved up or down in the meantime.
+type LeaderboardCursor struct {
+	Score     int
+	Timestamp time.Time
+	TalentID  TalentID
+}
+
+type LeaderboardPage struct {
+	Talents []TalentRank
+	// Total is the number of talents in the leaderboard
+	Total int
+	// Next is the cursor of the next page, nil if this is the last page
+	Next *LeaderboardCursor
+}
+
+// SaveResult is the outcome of saving a score event
+type SaveResult string
+
+const (
+	SaveResultSaved SaveResult = "saved"
+	// SaveResultDuplicate is an exact replay of a stored event, which is safe to ignore
+	SaveResultDuplicate SaveResult = "duplicate"
+	// SaveResultConflict is an event that reuses the ID of a stored event with a different payload
+	SaveResultConflict SaveResult = "conflict"
+)
+
 type Storage interface {
-	// SaveScoreEvent saves a score event; returns true if the event was saved, false if it was a duplicate
+	// SaveScoreEvent saves a score event; returns true if the event was saved, false if it was a duplicate.
+	// Returns ErrScoreEventConflict if the ID is already used by an event with a different payload.
 	SaveScoreEvent(ctx context.Context, event ScoreEvent) (bool, error)
-	// ConsumeScoreEvents returns score events in the order of insertion.
-	// Once an event is marked as Processed by #MarkScoreEventsAsProcessed,
-	// it won't be returned in the next call ConsumeScoreEvents call.
-	ConsumeScoreEvents(ctx context.Context, limit int) ([]ScoreEvent, error)
-	MarkScoreEventsAsProcessed(ctx context.Context, events []ScoreEvent) error
+	// SaveScoreEvents saves a batch of score events at once. results[i] is the outcome of events[i],
+	// which is compared both to the stored events and to the earlier events in the batch.
+	SaveScoreEvents(ctx context.Context, events []ScoreEvent) (results []SaveResult, err error)
+	// ConsumeScoreEvents claims up to limit score events that are due for the worker, in the order of insertion,
+	// except requeued dead letters, which go after the events waiting at the time.
+	// Failed events are due once their NextAttemptAt passes. A claimed event is leased to the worker and isn't returned
+	// to any worker until the lease expires, then it can be claimed again.
+	// The events of a talent are claimed in order: while one isn't due or is leased, the later ones aren't claimed.
+	ConsumeScoreEvents(ctx context.Context, workerID string, limit int) ([]ScoreEvent, error)
+	// ReleaseScoreEvents gives up the leases of the worker on the events without an attempt, so they can be claimed
+	// again right away. Returns ErrLeaseNotHeld listing the events that aren't leased to the worker.
+	ReleaseScoreEvents(ctx context.Context, workerID string, events []ScoreEvent) error
+	// ScoreEventsNotify returns a channel that's closed once events become consumable after the call, because they were
+	// saved or requeued. It's taken before consuming, so the events saved in between aren't missed.
+	// Failed events becoming due and expired leases aren't notified.
+	ScoreEventsNotify() <-chan struct{}
+	// MarkScoreEventsAsProcessed marks the events leased to the worker as processed and releases them.
+	// Returns ErrLeaseNotHeld listing the events that aren't leased to the worker, the others are still marked.
+	MarkScoreEventsAsProcessed(ctx context.Context, workerID string, events []ScoreEvent) error
+	// MarkScoreEventFailed records a failed processing attempt of an event leased to the worker and releases it.
+	// The event stays in the outbox to be retried, unless it's the last allowed attempt, then the event is dead-lettered.
+	// Returns ErrLeaseNotHeld if the event isn't leased to the worker.
+	MarkScoreEventFailed(ctx context.Context, workerID string, event ScoreEvent, reason error) error
+	// ListDeadLetters returns up to limit dead-lettered events starting from the 0-based position offset,
+	// oldest dead-lettered first, and the total number of dead-lettered events.
+	ListDeadLetters(ctx context.Context, offset, limit int) ([]ScoreEventStatus, int, error)
+	// RequeueDeadLetters moves the given dead-lettered events back to the outbox with their attempts reset.
+	// Returns the IDs of the requeued events, IDs of events that aren't dead-lettered are skipped.
+	RequeueDeadLetters(ctx context.Context, eventIDs []string) ([]string, error)
+	// RequeueAllDeadLetters moves every dead-lettered event back to the outbox, like RequeueDeadLetters
+	RequeueAllDeadLetters(ctx context.Context) ([]string, error)
+	// PurgeDeadLetters deletes the given dead-lettered events.
+	// Their IDs are still remembered, so a replay of them is a duplicate. Returns the IDs of the purged events.
+	PurgeDeadLetters(ctx context.Context, eventIDs []string) ([]string, error)
+	// PurgeAllDeadLetters deletes every dead-lettered event, like PurgeDeadLetters
+	PurgeAllDeadLetters(ctx context.Context) ([]string, error)
+	// GetScoreEventStatus returns the stored event and its processing state. Returns false if there's no such event.
+	GetScoreEventStatus(ctx context.Context, eventID string) (ScoreEventStatus, bool, error)
+	// RetractScoreEvent marks the event as retracted and removes its TalentScore from the rankings.
+	// Returns false if there's no such event, and ErrScoreEventRetracted if it was already retracted.
+	RetractScoreEvent(ctx context.Context, eventID string, reason string) (EventCorrection, bool, error)
+	// CorrectScoreEvent replaces the payload of the event with the same ID and its TalentScore with the given score,
+	// which keeps the season of the replaced score. The event is processed afterwards.
+	// Returns false if there's no such event, and ErrScoreEventRetracted if it was retracted.
+	CorrectScoreEvent(ctx context.Context, event ScoreEvent, score TalentScore, reason string) (EventCorrection, bool, error)
 
+	// SaveTalentScore saves the score of an event. It's ignored if the event is already processed or retracted,
+	// so a score calculated from an event that was changed in the meantime doesn't override the change.
 	SaveTalentScore(ctx context.Context, talentScore TalentScore) error
 
-	GetTopRankedTalents(ctx context.Context, limit int) ([]TalentRank, error)
-	FindTalentRank(ctx context.Context, talentID TalentID) (TalentRank, bool, error)
+	GetTopRankedTalents(ctx context.Context, key LeaderboardKey, limit int) ([]TalentRank, error)
+	FindTalentRank(ctx context.Context, key LeaderboardKey, talentID TalentID) (TalentRank, bool, error)
+	GetLeaderboardPage(ctx context.Context, key LeaderboardKey, req LeaderboardPageRequest) (LeaderboardPage, error)
+	// EstimateTalentRank returns the rank of the talent, which is exact if it's within exactRankLimit or if exactRankLimit
+	// is 0. Otherwise it may be estimated from a score histogram, when that's cheaper than finding the exact rank.
+	// Returns false if the talent is not in the leaderboard.
+	EstimateTalentRank(ctx context.Context, key LeaderboardKey, talentID TalentID, exactRankLimit int) (RankEstimate, bool, error)
+	// FindTalentNeighbors returns the talent's rank with up to above talents ranked right before it and up to below talents right after it.
+	// Returns false if the talent is not in the leaderboard.
+	FindTalentNeighbors(ctx context.Context, key LeaderboardKey, talentID TalentID, above, below int) ([]TalentRank, bool, error)
+
+	// GetTalentProfile returns the summary of all scores of the talent. Returns false if the talent has no scores.
+	GetTalentProfile(ctx context.Context, talentID TalentID) (TalentProfile, bool, error)
+
+	// RecordRanks adds the current rank and score of every talent in the all-time leaderboards of the current season
+	// to their rank history
+	RecordRanks(ctx context.Context) error
+	// FindPreviousRank returns the last recorded rank of the talent in the leaderboard.
+	// Returns false if there's none, or ranks aren't recorded for the leaderboard, which is the case for windows and archived seasons.
+	FindPreviousRank(ctx context.Context, key LeaderboardKey, talentID TalentID) (RankHistoryPoint, bool, error)
+	// GetRankHistory returns the points of the talent's rank history in the all-time leaderboard of the skill
+	// recorded in [from, to), oldest first. Zero from or to leaves that side unbounded.
+	GetRankHistory(ctx context.Context, skill Skill, talentID TalentID, from, to time.Time) ([]RankHistoryPoint, error)
+
+	// CloseSeason archives the final standings of the current season and starts a new, empty one.
+	// Returns the archived season.
+	CloseSeason(ctx context.Context) (Season, error)
+	// GetSeasons returns all seasons, the current one being the last
+	GetSeasons(ctx context.Context) ([]Season, error)
 }
 
 type Scorer interface {
@@ -68,20 +342,65 @@ type Scorer interface {
 type Service struct {
 	storage Storage
 	scorer  Scorer
+	// workers is the number of events scored in parallel
+	workers int
+	// workerID identifies the service to the storage when it claims events
+	workerID string
+	// idleBackoff is how long the worker waits for new events after empty polls
+	idleBackoff RetryPolicy
+}
+
+type ServiceOptions struct {
+	// Workers is the number of events ProcessScoreEvents scores in parallel (default is 1)
+	Workers int
+	// WorkerID identifies the service when it claims events, it must be unique among the services sharing a storage
+	// (default is the host name and the process ID)
+	WorkerID string
+	// IdleBackoff is how long ProcessScoreEvents waits for new events after each empty poll, unless the storage
+	// notifies it of new events earlier (default is 100ms doubling up to 5s)
+	IdleBackoff RetryPolicy
 }
 
 func NewService(storage Storage, scorer Scorer) *Service {
+	return NewServiceWithOptions(storage, scorer, ServiceOptions{})
+}
+
+func NewServiceWithOptions(storage Storage, scorer Scorer, opts ServiceOptions) *Service {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.WorkerID == "" {
+		opts.WorkerID = defaultWorkerID()
+	}
+	if opts.IdleBackoff.BaseDelay == 0 {
+		opts.IdleBackoff = RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 5 * time.Second}
+	}
 	return &Service{
-		storage: storage,
-		scorer:  scorer,
+		storage:     storage,
+		scorer:      scorer,
+		workers:     opts.Workers,
+		workerID:    opts.WorkerID,
+		idleBackoff: opts.IdleBackoff,
 	}
 }
 
+// defaultWorkerID returns "<hostname>-<pid>"
+func defaultWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
 // SaveScoreEvent saves a score event; returns true if the event was saved, false if it was a duplicate
 func (s *Service) SaveScoreEvent(ctx context.Context, event ScoreEvent) (bool, error) {
 	IncScoreEventsTotal()
 
 	saved, err := s.storage.SaveScoreEvent(ctx, event)
+	if errors.Is(err, ErrScoreEventConflict) {
+		IncScoreEventsConflict()
+	}
 	if err != nil {
 		return false, err
 	}
@@ -93,8 +412,114 @@ func (s *Service) SaveScoreEvent(ctx context.Context, event ScoreEvent) (bool, e
 	return saved, nil
 }
 
-func (s *Service) GetTopTalents(ctx context.Context, limit int) ([]TalentRank, error) {
-	talentRanks, err := s.storage.GetTopRankedTalents(ctx, limit)
+// GetScoreEventStatus returns the stored score event and its processing state
+func (s *Service) GetScoreEventStatus(ctx context.Context, eventID string) (ScoreEventStatus, error) {
+	status, found, err := s.storage.GetScoreEventStatus(ctx, eventID)
+	if err != nil {
+		return ScoreEventStatus{}, err
+	}
+	if !found {
+		return ScoreEventStatus{}, ErrScoreEventNotFound
+	}
+	return status, nil
+}
+
+// ListDeadLetters returns a page of the dead-lettered events and their total number
+func (s *Service) ListDeadLetters(ctx context.Context, offset, limit int) ([]ScoreEventStatus, int, error) {
+	return s.storage.ListDeadLetters(ctx, offset, limit)
+}
+
+// GetDeadLetter returns the dead-lettered event, or ErrScoreEventNotFound if the event isn't dead-lettered
+func (s *Service) GetDeadLetter(ctx context.Context, eventID string) (ScoreEventStatus, error) {
+	status, err := s.GetScoreEventStatus(ctx, eventID)
+	if err != nil {
+		return ScoreEventStatus{}, err
+	}
+	if status.State != ScoreEventDeadLettered {
+		return ScoreEventStatus{}, ErrScoreEventNotFound
+	}
+	return status, nil
+}
+
+// RequeueDeadLetters gives the given dead-lettered events another round of attempts
+func (s *Service) RequeueDeadLetters(ctx context.Context, eventIDs []string) ([]string, error) {
+	return s.storage.RequeueDeadLetters(ctx, eventIDs)
+}
+
+// RequeueAllDeadLetters gives every dead-lettered event another round of attempts
+func (s *Service) RequeueAllDeadLetters(ctx context.Context) ([]string, error) {
+	return s.storage.RequeueAllDeadLetters(ctx)
+}
+
+// PurgeDeadLetters deletes the given dead-lettered events
+func (s *Service) PurgeDeadLetters(ctx context.Context, eventIDs []string) ([]string, error) {
+	return s.storage.PurgeDeadLetters(ctx, eventIDs)
+}
+
+// PurgeAllDeadLetters deletes every dead-lettered event
+func (s *Service) PurgeAllDeadLetters(ctx context.Context) ([]string, error) {
+	return s.storage.PurgeAllDeadLetters(ctx)
+}
+
+// RetractScoreEvent withdraws the event, so it no longer counts in any leaderboard of the current season
+func (s *Service) RetractScoreEvent(ctx context.Context, eventID string, reason string) (EventCorrection, error) {
+	correction, found, err := s.storage.RetractScoreEvent(ctx, eventID, reason)
+	if err != nil {
+		return EventCorrection{}, err
+	}
+	if !found {
+		return EventCorrection{}, ErrScoreEventNotFound
+	}
+	return correction, nil
+}
+
+// CorrectScoreEvent replaces the stored event with the same ID by the given one.
+// The corrected event is scored right away, so its TalentScore replaces the old one at once.
+func (s *Service) CorrectScoreEvent(ctx context.Context, event ScoreEvent, reason string) (EventCorrection, error) {
+	score, err := s.scorer.CalculateScore(ctx, event.Skill, event.MetricValue)
+	if err != nil {
+		return EventCorrection{}, fmt.Errorf("calculate score: %w", err)
+	}
+
+	talentScore := TalentScore{
+		TalentID:  event.TalentID,
+		Skill:     event.Skill,
+		Score:     score,
+		EventID:   event.EventID,
+		Timestamp: event.Timestamp,
+	}
+	correction, found, err := s.storage.CorrectScoreEvent(ctx, event, talentScore, reason)
+	if err != nil {
+		return EventCorrection{}, err
+	}
+	if !found {
+		return EventCorrection{}, ErrScoreEventNotFound
+	}
+	return correction, nil
+}
+
+// SaveScoreEvents saves a batch of score events; results[i] is the outcome of events[i]
+func (s *Service) SaveScoreEvents(ctx context.Context, events []ScoreEvent) ([]SaveResult, error) {
+	results, err := s.storage.SaveScoreEvents(ctx, events)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		IncScoreEventsTotal()
+		switch result {
+		case SaveResultDuplicate:
+			IncScoreEventsDuplicate()
+		case SaveResultConflict:
+			IncScoreEventsConflict()
+		}
+	}
+
+	return results, nil
+}
+
+func (s *Service) GetTopTalents(ctx context.Context, key LeaderboardKey, limit int) ([]TalentRank, error) {
+	talentRanks, err := s.storage.GetTopRankedTalents(ctx, key, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -102,8 +527,12 @@ func (s *Service) GetTopTalents(ctx context.Context, limit int) ([]TalentRank, e
 	return talentRanks, nil
 }
 
-func (s *Service) GetTalentRank(ctx context.Context, talentID TalentID) (TalentRank, error) {
-	talentRank, found, err := s.storage.FindTalentRank(ctx, talentID)
+func (s *Service) GetLeaderboardPage(ctx context.Context, key LeaderboardKey, req LeaderboardPageRequest) (LeaderboardPage, error) {
+	return s.storage.GetLeaderboardPage(ctx, key, req)
+}
+
+func (s *Service) GetTalentRank(ctx context.Context, key LeaderboardKey, talentID TalentID) (TalentRank, error) {
+	talentRank, found, err := s.storage.FindTalentRank(ctx, key, talentID)
 	if err != nil {
 		return TalentRank{}, err
 	}
@@ -113,14 +542,87 @@ func (s *Service) GetTalentRank(ctx context.Context, talentID TalentID) (TalentR
 	return talentRank, nil
 }
 
-// ProcessScoreEvents consumes the score events, calculates the score for each and saves them.
-// There's a room for concurrency here, but I'll leave it for now.
-func (s *Service) ProcessScoreEvents(ctx context.Context, limit int) error {
-	ticker := time.NewTicker(100 * time.Millisecond)
+// EstimateTalentRank returns the rank of the talent, which is only exact within exactRankLimit (0 for always exact).
+// Ranks further down are estimated where that's much cheaper than the exact one.
+func (s *Service) EstimateTalentRank(ctx context.Context, key LeaderboardKey, talentID TalentID, exactRankLimit int) (RankEstimate, error) {
+	estimate, found, err := s.storage.EstimateTalentRank(ctx, key, talentID, exactRankLimit)
+	if err != nil {
+		return RankEstimate{}, err
+	}
+	if !found {
+		return RankEstimate{}, ErrTalentNotFound
+	}
+	return estimate, nil
+}
+
+// GetTalentNeighbors returns the talents ranked around the given talent, including itself
+func (s *Service) GetTalentNeighbors(ctx context.Context, key LeaderboardKey, talentID TalentID, above, below int) ([]TalentRank, error) {
+	talentRanks, found, err := s.storage.FindTalentNeighbors(ctx, key, talentID, above, below)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrTalentNotFound
+	}
+	return talentRanks, nil
+}
+
+func (s *Service) GetTalentProfile(ctx context.Context, talentID TalentID) (TalentProfile, error) {
+	profile, found, err := s.storage.GetTalentProfile(ctx, talentID)
+	if err != nil {
+		return TalentProfile{}, err
+	}
+	if !found {
+		return TalentProfile{}, ErrTalentNotFound
+	}
+	return profile, nil
+}
+
+// GetPreviousRank returns the last recorded rank of the talent, or false if there's none
+func (s *Service) GetPreviousRank(ctx context.Context, key LeaderboardKey, talentID TalentID) (RankHistoryPoint, bool, error) {
+	return s.storage.FindPreviousRank(ctx, key, talentID)
+}
+
+func (s *Service) GetRankHistory(ctx context.Context, skill Skill, talentID TalentID, from, to time.Time) ([]RankHistoryPoint, error) {
+	return s.storage.GetRankHistory(ctx, skill, talentID, from, to)
+}
+
+// RecordRankHistory records the ranks of all talents every interval, until the context is cancelled
+func (s *Service) RecordRankHistory(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
-		events, err := s.storage.ConsumeScoreEvents(ctx, limit)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.storage.RecordRanks(ctx); err != nil {
+				log.Printf("Error recording ranks: %v", err)
+			}
+		}
+	}
+}
+
+// CloseSeason freezes the current leaderboards as the final standings of the season, and starts a new season
+func (s *Service) CloseSeason(ctx context.Context) (Season, error) {
+	return s.storage.CloseSeason(ctx)
+}
+
+func (s *Service) GetSeasons(ctx context.Context) ([]Season, error) {
+	return s.storage.GetSeasons(ctx)
+}
+
+// ProcessScoreEvents consumes the score events, calculates the score for each and saves them.
+// The events of a batch are scored by a pool of workers, see processScoreEvents.
+// While there's nothing to consume, it sleeps until the storage notifies it of new events, backing off
+// between polls so failed events are retried once they're due, and expired leases of other workers are claimed.
+func (s *Service) ProcessScoreEvents(ctx context.Context, limit int) error {
+	emptyPolls := 0
+	for {
+		// The channel is taken before consuming, so events saved after the consume still wake the worker up
+		notify := s.storage.ScoreEventsNotify()
+		events, err := s.storage.ConsumeScoreEvents(ctx, s.workerID, limit)
 		if err != nil {
 			log.Printf("Error consuming score events: %v", err)
 			select {
@@ -131,41 +633,142 @@ func (s *Service) ProcessScoreEvents(ctx context.Context, limit int) error {
 			continue
 		}
 
-		var processedEvents []ScoreEvent
-		for _, event := range events {
-			score, err := s.scorer.CalculateScore(ctx, event.Skill, event.MetricValue)
-			if err != nil {
-				log.Printf("Error calculating score for event %s: %v", event.EventID, err)
-				continue
+		if len(events) > 0 {
+			emptyPolls = 0
+			if processedEvents := s.processScoreEvents(ctx, events); len(processedEvents) > 0 {
+				err = s.storage.MarkScoreEventsAsProcessed(ctx, s.workerID, processedEvents)
+				if err != nil {
+					log.Printf("Error marking events as processed: %v", err)
+				}
 			}
-
-			talentScore := TalentScore{
-				TalentID: event.TalentID,
-				Skill:    event.Skill,
-				Score:    score,
-				EventID:  event.EventID,
+			if ctx.Err() != nil {
+				return nil
 			}
+			continue
+		}
 
-			err = s.storage.SaveTalentScore(ctx, talentScore)
-			if err != nil {
-				log.Printf("Error saving talent score for event %s: %v", event.EventID, err)
-				continue
-			}
+		emptyPolls++
+		timer := time.NewTimer(s.idleBackoff.Delay(emptyPolls))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-notify:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
 
-			processedEvents = append(processedEvents, event)
+// processScoreEvents scores a batch of events in parallel, and returns the processed ones in the order of the batch.
+// The events of a talent are scored one after another in the order of the batch by the same worker, so they're
+// never scored concurrently or out of order. Once an event of a talent fails, its later events are released
+// unscored, and they're claimed again after the failed event. It returns once the whole batch is done, so the next batch can't
+// consume an event that's still being scored.
+func (s *Service) processScoreEvents(ctx context.Context, events []ScoreEvent) []ScoreEvent {
+	// Indexes of the events of each talent, talents in the order of their first event
+	var talents [][]int
+	talentIndex := make(map[TalentID]int)
+	for i, event := range events {
+		j, ok := talentIndex[event.TalentID]
+		if !ok {
+			j = len(talents)
+			talentIndex[event.TalentID] = j
+			talents = append(talents, nil)
 		}
+		talents[j] = append(talents[j], i)
+	}
 
-		if len(processedEvents) > 0 {
-			err = s.storage.MarkScoreEventsAsProcessed(ctx, processedEvents)
-			if err != nil {
-				log.Printf("Error marking events as processed: %v", err)
+	// Each event's slots are written by a single worker, so they need no lock
+	processed := make([]bool, len(events))
+	skipped := make([]bool, len(events))
+	queue := make(chan []int)
+	var wg sync.WaitGroup
+	for range min(s.workers, len(talents)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for indexes := range queue {
+				for j, i := range indexes {
+					processed[i] = s.processScoreEvent(ctx, events[i])
+					if !processed[i] {
+						// The later events of the talent wait for the failed one to be retried, so they're scored in order
+						for _, k := range indexes[j+1:] {
+							skipped[k] = true
+						}
+						break
+					}
+				}
 			}
+		}()
+	}
+	for _, indexes := range talents {
+		queue <- indexes
+	}
+	close(queue)
+	wg.Wait()
+
+	var processedEvents, skippedEvents []ScoreEvent
+	for i, event := range events {
+		if processed[i] {
+			processedEvents = append(processedEvents, event)
+		}
+		if skipped[i] {
+			skippedEvents = append(skippedEvents, event)
+		}
+	}
+	if len(skippedEvents) > 0 {
+		if err := s.storage.ReleaseScoreEvents(ctx, s.workerID, skippedEvents); err != nil {
+			log.Printf("Error releasing score events: %v", err)
 		}
+	}
+	return processedEvents
+}
 
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-ticker.C:
+// processScoreEvent calculates and saves the score of the event, returns false if it failed
+func (s *Service) processScoreEvent(ctx context.Context, event ScoreEvent) bool {
+	score, err := s.scorer.CalculateScore(ctx, event.Skill, event.MetricValue)
+	if err != nil {
+		log.Printf("Error calculating score for event %s: %v", event.EventID, err)
+		s.markScoreEventFailed(ctx, event, err)
+		return false
+	}
+
+	talentScore := TalentScore{
+		TalentID:  event.TalentID,
+		Skill:     event.Skill,
+		Score:     score,
+		EventID:   event.EventID,
+		Timestamp: event.Timestamp,
+	}
+
+	err = s.storage.SaveTalentScore(ctx, talentScore)
+	if err != nil {
+		log.Printf("Error saving talent score for event %s: %v", event.EventID, err)
+		s.markScoreEventFailed(ctx, event, err)
+		return false
+	}
+	return true
+}
+
+func (s *Service) markScoreEventFailed(ctx context.Context, event ScoreEvent, reason error) {
+	if err := s.storage.MarkScoreEventFailed(ctx, s.workerID, event, reason); err != nil {
+		log.Printf("Error marking event %s as failed: %v", event.EventID, err)
+		return
+	}
+
+	status, found, err := s.storage.GetScoreEventStatus(ctx, event.EventID)
+	if err != nil || !found {
+		return
+	}
+	switch status.State {
+	case ScoreEventDeadLettered:
+		IncScoreEventsDeadLettered()
+		log.Printf("Event %s dead-lettered after %d attempts", event.EventID, status.Attempts)
+	case ScoreEventFailed:
+		IncScoreEventsRetried()
+		if !status.NextAttemptAt.IsZero() {
+			log.Printf("Event %s failed %d times, next attempt at %s", event.EventID, status.Attempts, status.NextAttemptAt.Format(time.RFC3339))
 		}
 	}
 }
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -39,7 +42,7 @@ func TestService_ProcessScoreEvent_GetTopTalents(t *testing.T) {
 
 		// Use EventuallyWithT to wait for the background job to process the event
 		require.EventuallyWithT(t, func(c *assert.CollectT) {
-			talents, err := service.GetTopTalents(context.Background(), 10)
+			talents, err := service.GetTopTalents(context.Background(), LeaderboardKey{}, 10)
 			require.NoError(c, err)
 			require.Len(c, talents, 1)
 			assert.Equal(c, TalentID("talent-1"), talents[0].TalentID)
@@ -85,7 +88,7 @@ func TestService_ProcessScoreEvent_GetTopTalents(t *testing.T) {
 
 		// Use EventuallyWithT to wait for all talents to appear in leaderboard with correct ranking
 		require.EventuallyWithT(t, func(c *assert.CollectT) {
-			talents, err := service.GetTopTalents(context.Background(), 10)
+			talents, err := service.GetTopTalents(context.Background(), LeaderboardKey{}, 10)
 			require.NoError(c, err)
 			require.Len(c, talents, 3)
 
@@ -137,7 +140,7 @@ func TestService_GetTalentRank(t *testing.T) {
 
 		// Use EventuallyWithT to wait for the background job to process the event
 		require.EventuallyWithT(t, func(c *assert.CollectT) {
-			talent, err := service.GetTalentRank(context.Background(), TalentID("talent-1"))
+			talent, err := service.GetTalentRank(context.Background(), LeaderboardKey{}, TalentID("talent-1"))
 			require.NoError(c, err)
 			assert.Equal(c, TalentID("talent-1"), talent.TalentID)
 			assert.Equal(c, 80, talent.TalentScore.Score)
@@ -145,3 +148,1415 @@ func TestService_GetTalentRank(t *testing.T) {
 		}, 2*time.Second, 50*time.Millisecond, "Expected talent to appear in leaderboard with correct score and rank")
 	})
 }
+
+func TestService_SkillLeaderboard(t *testing.T) {
+	t.Run("skill leaderboard ranks talents by their best score of that skill", func(t *testing.T) {
+		storage := NewInMemStorage(10 * time.Millisecond)
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillShoot, Score: 90, EventID: "event-1"}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillPass, Score: 20, EventID: "event-2"}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillPass, Score: 40, EventID: "event-3"}))
+
+		require.EventuallyWithT(t, func(c *assert.CollectT) {
+			talents, err := service.GetTopTalents(ctx, LeaderboardKey{Skill: SkillPass}, 10)
+			require.NoError(c, err)
+			require.Len(c, talents, 2)
+			assert.Equal(c, TalentID("talent-2"), talents[0].TalentID)
+			assert.Equal(c, TalentID("talent-1"), talents[1].TalentID)
+			assert.Equal(c, 20, talents[1].TalentScore.Score)
+
+			talent, err := service.GetTalentRank(ctx, LeaderboardKey{Skill: SkillShoot}, "talent-1")
+			require.NoError(c, err)
+			assert.Equal(c, 1, talent.Rank)
+
+			_, err = service.GetTalentRank(ctx, LeaderboardKey{Skill: SkillShoot}, "talent-2")
+			assert.ErrorIs(c, err, ErrTalentNotFound)
+		}, 2*time.Second, 50*time.Millisecond)
+	})
+}
+
+func TestService_Aggregation(t *testing.T) {
+	t.Run("talents are ranked by the configured aggregation", func(t *testing.T) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{
+			LeaderboardMode: LeaderboardModeRealtime,
+			Aggregator:      SumOfSkillBestsAggregator{},
+		})
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillShoot, Score: 90, EventID: "event-1"}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillShoot, Score: 60, EventID: "event-2"}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillPass, Score: 50, EventID: "event-3"}))
+
+		talents, err := service.GetTopTalents(ctx, LeaderboardKey{}, 10)
+		require.NoError(t, err)
+		require.Len(t, talents, 2)
+		assert.Equal(t, TalentID("talent-2"), talents[0].TalentID)
+		assert.Equal(t, 110, talents[0].TalentScore.Score)
+		assert.Equal(t, TalentID("talent-1"), talents[1].TalentID)
+	})
+}
+
+func TestService_WindowLeaderboard(t *testing.T) {
+	t.Run("windows only include the scores of events in them", func(t *testing.T) {
+		now := time.Date(2025, 1, 29, 15, 0, 0, 0, time.UTC) // Wednesday
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{
+			LeaderboardMode: LeaderboardModeRealtime,
+			Now:             func() time.Time { return now },
+		})
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		scores := []TalentScore{
+			{TalentID: "talent-1", Skill: SkillShoot, Score: 90, EventID: "event-1", Timestamp: time.Date(2024, 12, 31, 10, 0, 0, 0, time.UTC)},
+			{TalentID: "talent-2", Skill: SkillShoot, Score: 70, EventID: "event-2", Timestamp: time.Date(2025, 1, 27, 10, 0, 0, 0, time.UTC)},
+			{TalentID: "talent-3", Skill: SkillShoot, Score: 50, EventID: "event-3", Timestamp: time.Date(2025, 1, 29, 9, 0, 0, 0, time.UTC)},
+		}
+		for _, score := range scores {
+			require.NoError(t, storage.SaveTalentScore(ctx, score))
+		}
+
+		talentIDs := func(key LeaderboardKey) []TalentID {
+			talents, err := service.GetTopTalents(ctx, key, 10)
+			require.NoError(t, err)
+			ids := make([]TalentID, len(talents))
+			for i, talent := range talents {
+				ids[i] = talent.TalentID
+			}
+			return ids
+		}
+
+		assert.Equal(t, []TalentID{"talent-1", "talent-2", "talent-3"}, talentIDs(LeaderboardKey{}))
+		assert.Equal(t, []TalentID{"talent-2", "talent-3"}, talentIDs(LeaderboardKey{Window: WindowMonthly}))
+		assert.Equal(t, []TalentID{"talent-2", "talent-3"}, talentIDs(LeaderboardKey{Window: WindowWeekly}))
+		assert.Equal(t, []TalentID{"talent-3"}, talentIDs(LeaderboardKey{Window: WindowDaily}))
+		assert.Equal(t, []TalentID{"talent-1"}, talentIDs(LeaderboardKey{Window: WindowMonthly, At: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)}))
+
+		talent, err := service.GetTalentRank(ctx, LeaderboardKey{Window: WindowWeekly}, "talent-3")
+		require.NoError(t, err)
+		assert.Equal(t, 2, talent.Rank)
+	})
+
+	t.Run("window boundaries follow the timezone", func(t *testing.T) {
+		tokyo := time.FixedZone("Asia/Tokyo", 9*60*60)
+		start, end := WindowDaily.Bounds(time.Date(2025, 1, 26, 20, 0, 0, 0, time.UTC), tokyo)
+		assert.Equal(t, time.Date(2025, 1, 27, 0, 0, 0, 0, tokyo), start)
+		assert.Equal(t, time.Date(2025, 1, 28, 0, 0, 0, 0, tokyo), end)
+
+		start, end = WindowWeekly.Bounds(time.Date(2025, 2, 2, 23, 0, 0, 0, time.UTC), time.UTC)
+		assert.Equal(t, time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC), start)
+		assert.Equal(t, time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC), end)
+	})
+
+	t.Run("rollover waits for the end of the day by the storage clock, until closed", func(t *testing.T) {
+		// The clock never moves, so the day never ends by it
+		var reads atomic.Int64
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{
+			LeaderboardMode: LeaderboardModeRealtime,
+			Now: func() time.Time {
+				reads.Add(1)
+				return time.Date(2025, 1, 29, 23, 59, 59, 0, time.UTC)
+			},
+		})
+		constructed := reads.Load()
+
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, constructed, reads.Load())
+
+		done := make(chan struct{})
+		go func() {
+			storage.Close()
+			storage.Close()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Close didn't stop the rollover")
+		}
+	})
+}
+
+func TestService_CloseSeason(t *testing.T) {
+	t.Run("closed season keeps its final standings and the new season starts empty", func(t *testing.T) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime})
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillShoot, Score: 90, EventID: "event-1"}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillPass, Score: 70, EventID: "event-2"}))
+
+		season, err := service.CloseSeason(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, season.ID)
+		assert.False(t, season.EndedAt.IsZero())
+
+		talents, err := service.GetTopTalents(ctx, LeaderboardKey{}, 10)
+		require.NoError(t, err)
+		assert.Empty(t, talents)
+
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillPass, Score: 50, EventID: "event-3"}))
+
+		talents, err = service.GetTopTalents(ctx, LeaderboardKey{}, 10)
+		require.NoError(t, err)
+		require.Len(t, talents, 1)
+		assert.Equal(t, 50, talents[0].TalentScore.Score)
+
+		talents, err = service.GetTopTalents(ctx, LeaderboardKey{Season: 1}, 10)
+		require.NoError(t, err)
+		require.Len(t, talents, 2)
+		assert.Equal(t, TalentID("talent-1"), talents[0].TalentID)
+		assert.Equal(t, 70, talents[1].TalentScore.Score)
+
+		talent, err := service.GetTalentRank(ctx, LeaderboardKey{Season: 1, Skill: SkillPass}, "talent-2")
+		require.NoError(t, err)
+		assert.Equal(t, 1, talent.Rank)
+
+		_, err = service.GetTopTalents(ctx, LeaderboardKey{Season: 5}, 10)
+		assert.ErrorIs(t, err, ErrSeasonNotFound)
+
+		seasons, err := service.GetSeasons(ctx)
+		require.NoError(t, err)
+		require.Len(t, seasons, 2)
+		assert.Equal(t, 2, seasons[1].ID)
+		assert.True(t, seasons[1].EndedAt.IsZero())
+	})
+}
+
+func TestService_RealtimeLeaderboard(t *testing.T) {
+	t.Run("rank is updated as soon as the talent score is saved", func(t *testing.T) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime})
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillDribble, Score: 50, EventID: "event-1"}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillPass, Score: 60, EventID: "event-2"}))
+
+		talent, err := service.GetTalentRank(ctx, LeaderboardKey{}, "talent-1")
+		require.NoError(t, err)
+		assert.Equal(t, 2, talent.Rank)
+
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillShoot, Score: 70, EventID: "event-3"}))
+
+		talents, err := service.GetTopTalents(ctx, LeaderboardKey{}, 10)
+		require.NoError(t, err)
+		require.Len(t, talents, 2)
+		assert.Equal(t, TalentID("talent-1"), talents[0].TalentID)
+		assert.Equal(t, 70, talents[0].TalentScore.Score)
+		assert.Equal(t, 1, talents[0].Rank)
+		assert.Equal(t, TalentID("talent-2"), talents[1].TalentID)
+		assert.Equal(t, 2, talents[1].Rank)
+	})
+}
+
+func TestService_GetTalentNeighbors(t *testing.T) {
+	for _, mode := range []LeaderboardMode{LeaderboardModePeriodic, LeaderboardModeRealtime} {
+		t.Run(string(mode)+" returns the talents ranked around the talent", func(t *testing.T) {
+			storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: mode, RefreshInterval: 10 * time.Millisecond})
+			service := NewService(storage, NewLinearScorer())
+			ctx := context.Background()
+
+			for i := 1; i <= 6; i++ {
+				talentScore := TalentScore{TalentID: TalentID(fmt.Sprintf("talent-%d", i)), Skill: SkillShoot, Score: 100 - i, EventID: fmt.Sprintf("event-%d", i)}
+				require.NoError(t, storage.SaveTalentScore(ctx, talentScore))
+			}
+
+			require.EventuallyWithT(t, func(c *assert.CollectT) {
+				talents, err := service.GetTalentNeighbors(ctx, LeaderboardKey{}, "talent-3", 1, 2)
+				require.NoError(c, err)
+				require.Len(c, talents, 4)
+				assert.Equal(c, TalentID("talent-2"), talents[0].TalentID)
+				assert.Equal(c, 2, talents[0].Rank)
+				assert.Equal(c, TalentID("talent-3"), talents[1].TalentID)
+				assert.Equal(c, 3, talents[1].Rank)
+				assert.Equal(c, TalentID("talent-5"), talents[3].TalentID)
+				assert.Equal(c, 5, talents[3].Rank)
+
+				// The neighborhood is cut at the edges of the leaderboard
+				talents, err = service.GetTalentNeighbors(ctx, LeaderboardKey{}, "talent-1", 5, 1)
+				require.NoError(c, err)
+				require.Len(c, talents, 2)
+				assert.Equal(c, TalentID("talent-1"), talents[0].TalentID)
+
+				talents, err = service.GetTalentNeighbors(ctx, LeaderboardKey{}, "talent-6", 1, 5)
+				require.NoError(c, err)
+				require.Len(c, talents, 2)
+				assert.Equal(c, TalentID("talent-6"), talents[1].TalentID)
+
+				_, err = service.GetTalentNeighbors(ctx, LeaderboardKey{}, "talent-7", 5, 5)
+				assert.ErrorIs(c, err, ErrTalentNotFound)
+			}, 2*time.Second, 50*time.Millisecond)
+		})
+	}
+}
+
+func TestService_GetLeaderboardPage(t *testing.T) {
+	t.Run("cursor continues after the previous page when the leaderboard changes", func(t *testing.T) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime})
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		for i := 1; i <= 5; i++ {
+			talentScore := TalentScore{TalentID: TalentID(fmt.Sprintf("talent-%d", i)), Skill: SkillShoot, Score: 100 - i, EventID: fmt.Sprintf("event-%d", i)}
+			require.NoError(t, storage.SaveTalentScore(ctx, talentScore))
+		}
+
+		page, err := service.GetLeaderboardPage(ctx, LeaderboardKey{}, LeaderboardPageRequest{Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Talents, 2)
+		assert.Equal(t, 5, page.Total)
+		require.NotNil(t, page.Next)
+		assert.Equal(t, TalentID("talent-2"), page.Next.TalentID)
+
+		// A new talent takes the lead, which shifts every offset by one, but not the cursor
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-0", Skill: SkillShoot, Score: 100, EventID: "event-0"}))
+
+		page, err = service.GetLeaderboardPage(ctx, LeaderboardKey{}, LeaderboardPageRequest{After: page.Next, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Talents, 2)
+		assert.Equal(t, 6, page.Total)
+		assert.Equal(t, TalentID("talent-3"), page.Talents[0].TalentID)
+		assert.Equal(t, 4, page.Talents[0].Rank)
+
+		page, err = service.GetLeaderboardPage(ctx, LeaderboardKey{}, LeaderboardPageRequest{After: page.Next, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Talents, 1)
+		assert.Equal(t, TalentID("talent-5"), page.Talents[0].TalentID)
+		assert.Nil(t, page.Next)
+
+		page, err = service.GetLeaderboardPage(ctx, LeaderboardKey{}, LeaderboardPageRequest{Offset: 4, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, page.Talents, 2)
+		assert.Equal(t, 5, page.Talents[0].Rank)
+		assert.Nil(t, page.Next)
+	})
+}
+
+func TestService_RankModes(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	// talent-b achieved 80 before talent-a, so it's listed first despite its ID
+	scores := []TalentScore{
+		{TalentID: "talent-a", Skill: SkillShoot, Score: 80, EventID: "event-1", Timestamp: base.Add(time.Minute)},
+		{TalentID: "talent-b", Skill: SkillShoot, Score: 80, EventID: "event-2", Timestamp: base},
+		{TalentID: "talent-c", Skill: SkillShoot, Score: 90, EventID: "event-3", Timestamp: base},
+		{TalentID: "talent-d", Skill: SkillShoot, Score: 70, EventID: "event-4", Timestamp: base},
+	}
+	expectedRanks := map[RankMode][]int{
+		RankModeOrdinal:     {1, 2, 3, 4},
+		RankModeCompetition: {1, 2, 2, 4},
+		RankModeDense:       {1, 2, 2, 3},
+	}
+
+	for _, leaderboardMode := range []LeaderboardMode{LeaderboardModePeriodic, LeaderboardModeRealtime} {
+		for rankMode, ranks := range expectedRanks {
+			t.Run(fmt.Sprintf("%s leaderboard with %s ranks", leaderboardMode, rankMode), func(t *testing.T) {
+				storage := NewInMemStorageWithOptions(InMemStorageOptions{
+					LeaderboardMode: leaderboardMode,
+					RankMode:        rankMode,
+					RefreshInterval: 10 * time.Millisecond,
+				})
+				service := NewService(storage, NewLinearScorer())
+				ctx := context.Background()
+
+				for _, score := range scores {
+					require.NoError(t, storage.SaveTalentScore(ctx, score))
+				}
+
+				require.EventuallyWithT(t, func(c *assert.CollectT) {
+					talents, err := service.GetTopTalents(ctx, LeaderboardKey{}, 10)
+					require.NoError(c, err)
+					require.Len(c, talents, 4)
+					for i, talentID := range []TalentID{"talent-c", "talent-b", "talent-a", "talent-d"} {
+						assert.Equal(c, talentID, talents[i].TalentID)
+						assert.Equal(c, ranks[i], talents[i].Rank)
+					}
+
+					talent, err := service.GetTalentRank(ctx, LeaderboardKey{}, "talent-a")
+					require.NoError(c, err)
+					assert.Equal(c, ranks[2], talent.Rank)
+
+					// A page starting in the middle of a tie keeps the ranks of the whole leaderboard
+					page, err := service.GetLeaderboardPage(ctx, LeaderboardKey{}, LeaderboardPageRequest{Offset: 2, Limit: 2})
+					require.NoError(c, err)
+					require.Len(c, page.Talents, 2)
+					assert.Equal(c, ranks[2], page.Talents[0].Rank)
+					assert.Equal(c, ranks[3], page.Talents[1].Rank)
+				}, 2*time.Second, 50*time.Millisecond)
+			})
+		}
+	}
+}
+
+func TestService_EstimateTalentRank(t *testing.T) {
+	for _, mode := range []LeaderboardMode{LeaderboardModePeriodic, LeaderboardModeRealtime} {
+		t.Run(string(mode)+" finds exact ranks in maintained leaderboards", func(t *testing.T) {
+			storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: mode, RefreshInterval: 10 * time.Millisecond})
+			service := NewService(storage, NewLinearScorer())
+			ctx := context.Background()
+
+			for i := 1; i <= 200; i++ {
+				talentScore := TalentScore{TalentID: TalentID(fmt.Sprintf("talent-%d", i)), Skill: SkillShoot, Score: i * 10, EventID: fmt.Sprintf("event-%d", i)}
+				require.NoError(t, storage.SaveTalentScore(ctx, talentScore))
+			}
+
+			require.EventuallyWithT(t, func(c *assert.CollectT) {
+				// The lookup costs as much as an estimate, so the rank is exact even below the limit
+				estimate, err := service.EstimateTalentRank(ctx, LeaderboardKey{}, "talent-194", 5)
+				require.NoError(c, err)
+				assert.True(c, estimate.Exact)
+				assert.Equal(c, 200, estimate.Total)
+				assert.Equal(c, 1940, estimate.Score)
+				assert.Equal(c, 7, estimate.Rank)
+				assert.Equal(c, 3.5, estimate.Percentile())
+
+				_, err = service.EstimateTalentRank(ctx, LeaderboardKey{}, "talent-201", 5)
+				assert.ErrorIs(c, err, ErrTalentNotFound)
+			}, 2*time.Second, 50*time.Millisecond)
+		})
+	}
+
+	t.Run("estimates ranks below the limit in leaderboards that aren't maintained", func(t *testing.T) {
+		now := time.Date(2025, 1, 29, 15, 0, 0, 0, time.UTC)
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{
+			LeaderboardMode: LeaderboardModeRealtime,
+			Now:             func() time.Time { return now },
+		})
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		yesterday := time.Date(2025, 1, 28, 10, 0, 0, 0, time.UTC)
+		for i := 1; i <= 200; i++ {
+			talentScore := TalentScore{TalentID: TalentID(fmt.Sprintf("talent-%d", i)), Skill: SkillShoot, Score: i * 10, EventID: fmt.Sprintf("event-%d", i), Timestamp: yesterday}
+			require.NoError(t, storage.SaveTalentScore(ctx, talentScore))
+		}
+		key := LeaderboardKey{Window: WindowDaily, At: yesterday}
+
+		estimate, err := service.EstimateTalentRank(ctx, key, "talent-194", 5)
+		require.NoError(t, err)
+		assert.False(t, estimate.Exact)
+		assert.Equal(t, 200, estimate.Total)
+		assert.Equal(t, 1940, estimate.Score)
+		// Scores in the thousands share buckets of 16, so the estimate is close to the exact rank of 7, not equal to it
+		assert.InDelta(t, 7, estimate.Rank, 2)
+		assert.InDelta(t, 3.5, estimate.Percentile(), 1)
+
+		estimate, err = service.EstimateTalentRank(ctx, key, "talent-198", 5)
+		require.NoError(t, err)
+		assert.True(t, estimate.Exact)
+		assert.Equal(t, 3, estimate.Rank)
+
+		estimate, err = service.EstimateTalentRank(ctx, key, "talent-194", 0)
+		require.NoError(t, err)
+		assert.True(t, estimate.Exact)
+		assert.Equal(t, 7, estimate.Rank)
+
+		_, err = service.EstimateTalentRank(ctx, key, "talent-201", 5)
+		assert.ErrorIs(t, err, ErrTalentNotFound)
+	})
+}
+
+func TestService_RankHistory(t *testing.T) {
+	t.Run("records rank changes and returns the previous rank", func(t *testing.T) {
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{
+			LeaderboardMode: LeaderboardModeRealtime,
+			Now:             func() time.Time { return now },
+		})
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		_, found, err := service.GetPreviousRank(ctx, LeaderboardKey{}, "talent-1")
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillShoot, Score: 50, EventID: "event-1"}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillShoot, Score: 60, EventID: "event-2"}))
+		require.NoError(t, storage.RecordRanks(ctx))
+
+		// Nothing changed for talent-2, so only talent-1 gets a new point
+		now = now.Add(24 * time.Hour)
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillShoot, Score: 70, EventID: "event-3"}))
+		require.NoError(t, storage.RecordRanks(ctx))
+
+		now = now.Add(24 * time.Hour)
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillShoot, Score: 80, EventID: "event-4"}))
+
+		previous, found, err := service.GetPreviousRank(ctx, LeaderboardKey{}, "talent-2")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, 2, previous.Rank)
+
+		points, err := service.GetRankHistory(ctx, "", "talent-1", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, points, 2)
+		assert.Equal(t, 2, points[0].Rank)
+		assert.Equal(t, 50, points[0].Score)
+		assert.Equal(t, 1, points[1].Rank)
+		assert.Equal(t, 70, points[1].Score)
+
+		points, err = service.GetRankHistory(ctx, "", "talent-2", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, points, 2)
+
+		points, err = service.GetRankHistory(ctx, SkillShoot, "talent-1", now.Add(-time.Hour), time.Time{})
+		require.NoError(t, err)
+		assert.Empty(t, points)
+
+		// Windows have no rank history
+		_, found, err = service.GetPreviousRank(ctx, LeaderboardKey{Window: WindowDaily}, "talent-2")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("drops points older than the retention, except the last one of a talent", func(t *testing.T) {
+		start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		now := start
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{
+			LeaderboardMode:      LeaderboardModeRealtime,
+			Now:                  func() time.Time { return now },
+			RankHistoryRetention: 48 * time.Hour,
+		})
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillShoot, Score: 10, EventID: "event-0"}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillShoot, Score: 1000, EventID: "event-quiet"}))
+		for day := range 4 {
+			now = start.Add(time.Duration(day) * 24 * time.Hour)
+			talentScore := TalentScore{TalentID: "talent-1", Skill: SkillShoot, Score: 10 * (day + 2), EventID: fmt.Sprintf("event-%d", day+1)}
+			require.NoError(t, storage.SaveTalentScore(ctx, talentScore))
+			require.NoError(t, storage.RecordRanks(ctx))
+		}
+
+		points, err := service.GetRankHistory(ctx, "", "talent-1", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, points, 3)
+		assert.Equal(t, start.Add(24*time.Hour), points[0].At)
+		assert.Equal(t, 50, points[2].Score)
+
+		// talent-2 never changed, so its only point is kept
+		previous, found, err := service.GetPreviousRank(ctx, LeaderboardKey{}, "talent-2")
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, start, previous.At)
+	})
+}
+
+func TestService_GetTalentProfile(t *testing.T) {
+	t.Run("summarizes all scores of the talent", func(t *testing.T) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime})
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+		base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillShoot, Score: 40, EventID: "event-1", Timestamp: base.Add(time.Hour)}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillShoot, Score: 70, EventID: "event-2", Timestamp: base}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-1", Skill: SkillPass, Score: 30, EventID: "event-3", Timestamp: base.Add(2 * time.Hour)}))
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillPass, Score: 90, EventID: "event-4", Timestamp: base}))
+
+		profile, err := service.GetTalentProfile(ctx, "talent-1")
+		require.NoError(t, err)
+		assert.Equal(t, 3, profile.ScoreCount)
+		assert.Equal(t, base, profile.FirstActivityAt)
+		assert.Equal(t, base.Add(2*time.Hour), profile.LastActivityAt)
+		assert.Equal(t, 2, profile.Rank)
+		require.Len(t, profile.Bests, 2)
+		assert.Equal(t, 70, profile.Bests[SkillShoot].Score)
+		assert.Equal(t, "event-2", profile.Bests[SkillShoot].EventID)
+		assert.Equal(t, "event-3", profile.Bests[SkillPass].EventID)
+
+		_, err = service.GetTalentProfile(ctx, "talent-3")
+		assert.ErrorIs(t, err, ErrTalentNotFound)
+	})
+}
+
+// flakyScorer fails the first failures calls for each metric value, then scores like LinearScorer
+type flakyScorer struct {
+	mu       sync.Mutex
+	failures int
+	calls    map[int]int
+}
+
+func newFlakyScorer(failures int) *flakyScorer {
+	return &flakyScorer{failures: failures, calls: make(map[int]int)}
+}
+
+func (s *flakyScorer) CalculateScore(ctx context.Context, skill Skill, metricValue int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[metricValue]++
+	if s.calls[metricValue] <= s.failures {
+		return 0, fmt.Errorf("scorer unavailable")
+	}
+	return metricValue, nil
+}
+
+func TestService_GetScoreEventStatus(t *testing.T) {
+	t.Run("tracks failed attempts until the event is processed", func(t *testing.T) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime})
+		service := NewService(storage, newFlakyScorer(2))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		event := ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 40, Timestamp: time.Now()}
+		_, err := service.SaveScoreEvent(ctx, event)
+		require.NoError(t, err)
+
+		status, err := service.GetScoreEventStatus(ctx, "event-1")
+		require.NoError(t, err)
+		assert.Equal(t, ScoreEventPending, status.State)
+		assert.Equal(t, 0, status.Attempts)
+		assert.Nil(t, status.TalentScore)
+
+		go service.ProcessScoreEvents(ctx, 10)
+
+		require.EventuallyWithT(t, func(c *assert.CollectT) {
+			status, err := service.GetScoreEventStatus(ctx, "event-1")
+			require.NoError(c, err)
+			assert.Equal(c, ScoreEventProcessed, status.State)
+			assert.Equal(c, 3, status.Attempts)
+			assert.Equal(c, "scorer unavailable", status.LastError)
+			require.NotNil(c, status.TalentScore)
+			assert.Equal(c, 40, status.TalentScore.Score)
+		}, 2*time.Second, 50*time.Millisecond)
+
+		_, err = service.GetScoreEventStatus(ctx, "event-2")
+		assert.ErrorIs(t, err, ErrScoreEventNotFound)
+	})
+}
+
+func TestService_SaveScoreEvents(t *testing.T) {
+	t.Run("saves a batch and reports duplicates", func(t *testing.T) {
+		storage := NewInMemStorage(10 * time.Millisecond)
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		_, err := service.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10})
+		require.NoError(t, err)
+
+		saved, err := service.SaveScoreEvents(ctx, []ScoreEvent{
+			{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10},
+			{EventID: "event-2", TalentID: "talent-2", Skill: SkillShoot, MetricValue: 20},
+			{EventID: "event-2", TalentID: "talent-2", Skill: SkillShoot, MetricValue: 20},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []SaveResult{SaveResultDuplicate, SaveResultSaved, SaveResultDuplicate}, saved)
+
+		events, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, "event-2", events[1].EventID)
+	})
+	t.Run("reports events that reuse an ID with a different payload", func(t *testing.T) {
+		storage := NewInMemStorage(10 * time.Millisecond)
+		service := NewService(storage, NewLinearScorer())
+		ctx := context.Background()
+
+		_, err := service.SaveScoreEvent(ctx, ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10})
+		require.NoError(t, err)
+
+		saved, err := service.SaveScoreEvents(ctx, []ScoreEvent{
+			{EventID: "event-1", TalentID: "talent-2", Skill: SkillPass, MetricValue: 10},
+			{EventID: "event-2", TalentID: "talent-2", Skill: SkillShoot, MetricValue: 20},
+			{EventID: "event-2", TalentID: "talent-2", Skill: SkillShoot, MetricValue: 30},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []SaveResult{SaveResultConflict, SaveResultSaved, SaveResultConflict}, saved)
+	})
+}
+
+func TestService_SaveScoreEvent_Conflict(t *testing.T) {
+	storage := NewInMemStorage(10 * time.Millisecond)
+	service := NewService(storage, NewLinearScorer())
+	ctx := context.Background()
+
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	event := ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10, Timestamp: timestamp}
+	saved, err := service.SaveScoreEvent(ctx, event)
+	require.NoError(t, err)
+	require.True(t, saved)
+
+	t.Run("an exact replay is a duplicate", func(t *testing.T) {
+		replay := event
+		replay.Timestamp = timestamp.In(time.FixedZone("CET", 3600))
+		saved, err := service.SaveScoreEvent(ctx, replay)
+		require.NoError(t, err)
+		assert.False(t, saved)
+	})
+
+	t.Run("a different payload is a conflict", func(t *testing.T) {
+		conflicts := atomic.LoadUint64(&ScoreEventsConflicts)
+
+		for _, changed := range []ScoreEvent{
+			{EventID: "event-1", TalentID: "talent-2", Skill: SkillPass, MetricValue: 10, Timestamp: timestamp},
+			{EventID: "event-1", TalentID: "talent-1", Skill: SkillShoot, MetricValue: 10, Timestamp: timestamp},
+			{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 11, Timestamp: timestamp},
+			{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10, Timestamp: timestamp.Add(time.Second)},
+		} {
+			_, err := service.SaveScoreEvent(ctx, changed)
+			assert.ErrorIs(t, err, ErrScoreEventConflict)
+		}
+		assert.Equal(t, conflicts+4, atomic.LoadUint64(&ScoreEventsConflicts))
+
+		status, err := service.GetScoreEventStatus(ctx, "event-1")
+		require.NoError(t, err)
+		assert.Equal(t, event, status.Event, "the stored event must not change")
+	})
+}
+
+func TestService_CorrectScoreEvent(t *testing.T) {
+	// setup saves and processes event-1 of talent-1 with 80 and event-2 of talent-2 with 60
+	setup := func(t *testing.T) (*Service, *InMemStorage) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime})
+		service := NewService(storage, NewLinearScorer())
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+
+		timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		for _, event := range []ScoreEvent{
+			{EventID: "event-1", TalentID: "talent-1", Skill: SkillDribble, MetricValue: 80, Timestamp: timestamp},
+			{EventID: "event-2", TalentID: "talent-2", Skill: SkillDribble, MetricValue: 60, Timestamp: timestamp},
+		} {
+			_, err := service.SaveScoreEvent(ctx, event)
+			require.NoError(t, err)
+		}
+		go service.ProcessScoreEvents(ctx, 10)
+
+		require.EventuallyWithT(t, func(c *assert.CollectT) {
+			talents, err := service.GetTopTalents(ctx, LeaderboardKey{}, 10)
+			require.NoError(c, err)
+			assert.Len(c, talents, 2)
+		}, 2*time.Second, 20*time.Millisecond)
+		return service, storage
+	}
+
+	ranking := func(t *testing.T, service *Service) map[TalentID]int {
+		talents, err := service.GetTopTalents(context.Background(), LeaderboardKey{}, 10)
+		require.NoError(t, err)
+		scores := make(map[TalentID]int)
+		for _, talent := range talents {
+			scores[talent.TalentID] = talent.TalentScore.Score
+		}
+		return scores
+	}
+
+	t.Run("retraction removes the score from the rankings", func(t *testing.T) {
+		service, _ := setup(t)
+		ctx := context.Background()
+
+		correction, err := service.RetractScoreEvent(ctx, "event-1", "recorded for the wrong talent")
+		require.NoError(t, err)
+		assert.Equal(t, CorrectionRetract, correction.Action)
+		require.NotNil(t, correction.PreviousScore)
+		assert.Equal(t, 80, correction.PreviousScore.Score)
+		assert.Nil(t, correction.Score)
+
+		assert.Equal(t, map[TalentID]int{"talent-2": 60}, ranking(t, service))
+
+		status, err := service.GetScoreEventStatus(ctx, "event-1")
+		require.NoError(t, err)
+		assert.Equal(t, ScoreEventRetracted, status.State)
+		assert.Nil(t, status.TalentScore)
+		require.Len(t, status.Corrections, 1)
+		assert.Equal(t, "recorded for the wrong talent", status.Corrections[0].Reason)
+
+		_, err = service.RetractScoreEvent(ctx, "event-1", "")
+		assert.ErrorIs(t, err, ErrScoreEventRetracted)
+		_, err = service.RetractScoreEvent(ctx, "event-3", "")
+		assert.ErrorIs(t, err, ErrScoreEventNotFound)
+
+		saved, err := service.SaveScoreEvent(ctx, status.Event)
+		require.NoError(t, err)
+		assert.False(t, saved, "a replay of a retracted event must not bring it back")
+	})
+
+	t.Run("correction replaces the score", func(t *testing.T) {
+		service, _ := setup(t)
+		ctx := context.Background()
+
+		status, err := service.GetScoreEventStatus(ctx, "event-1")
+		require.NoError(t, err)
+		event := status.Event
+		event.MetricValue = 40
+
+		correction, err := service.CorrectScoreEvent(ctx, event, "typo in the metric")
+		require.NoError(t, err)
+		assert.Equal(t, CorrectionCorrect, correction.Action)
+		assert.Equal(t, 80, correction.Previous.MetricValue)
+		require.NotNil(t, correction.Score)
+		assert.Equal(t, 40, correction.Score.Score)
+		assert.Equal(t, 1, correction.Score.Season)
+
+		assert.Equal(t, map[TalentID]int{"talent-1": 40, "talent-2": 60}, ranking(t, service))
+
+		status, err = service.GetScoreEventStatus(ctx, "event-1")
+		require.NoError(t, err)
+		assert.Equal(t, event, status.Event)
+		assert.Equal(t, ScoreEventProcessed, status.State)
+		require.NotNil(t, status.TalentScore)
+		assert.Equal(t, 40, status.TalentScore.Score)
+
+		saved, err := service.SaveScoreEvent(ctx, correction.Previous)
+		require.NoError(t, err)
+		assert.False(t, saved, "a replay of the event as it was received is still a duplicate")
+	})
+
+	t.Run("correction moves the score to another talent", func(t *testing.T) {
+		service, _ := setup(t)
+		ctx := context.Background()
+
+		status, err := service.GetScoreEventStatus(ctx, "event-1")
+		require.NoError(t, err)
+		event := status.Event
+		event.TalentID = "talent-3"
+
+		_, err = service.CorrectScoreEvent(ctx, event, "recorded for the wrong talent")
+		require.NoError(t, err)
+		assert.Equal(t, map[TalentID]int{"talent-2": 60, "talent-3": 80}, ranking(t, service))
+
+		_, err = service.GetTalentProfile(ctx, "talent-1")
+		assert.ErrorIs(t, err, ErrTalentNotFound)
+	})
+
+	t.Run("a score calculated from the event before the change is ignored", func(t *testing.T) {
+		service, storage := setup(t)
+		ctx := context.Background()
+
+		_, err := service.RetractScoreEvent(ctx, "event-2", "")
+		require.NoError(t, err)
+
+		require.NoError(t, storage.SaveTalentScore(ctx, TalentScore{TalentID: "talent-2", Skill: SkillDribble, Score: 60, EventID: "event-2"}))
+		err = storage.MarkScoreEventsAsProcessed(ctx, "worker-1", []ScoreEvent{{EventID: "event-2"}})
+		assert.ErrorIs(t, err, ErrLeaseNotHeld)
+
+		assert.Equal(t, map[TalentID]int{"talent-1": 80}, ranking(t, service))
+		status, err := service.GetScoreEventStatus(ctx, "event-2")
+		require.NoError(t, err)
+		assert.Equal(t, ScoreEventRetracted, status.State)
+	})
+}
+
+// poisonScorer fails for the poisoned metric values, and scores like LinearScorer otherwise
+type poisonScorer struct {
+	mu       sync.Mutex
+	poisoned map[int]bool
+}
+
+func (s *poisonScorer) CalculateScore(ctx context.Context, skill Skill, metricValue int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.poisoned[metricValue] {
+		return 0, fmt.Errorf("poisoned metric")
+	}
+	return metricValue, nil
+}
+
+func (s *poisonScorer) cure(metricValue int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.poisoned, metricValue)
+}
+
+func TestService_DeadLetters(t *testing.T) {
+	storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime, MaxAttempts: 3})
+	scorer := &poisonScorer{poisoned: map[int]bool{1: true, 2: true, 3: true}}
+	service := NewService(storage, scorer)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := []ScoreEvent{
+		{EventID: "poison-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 1, Timestamp: time.Now()},
+		{EventID: "poison-2", TalentID: "talent-2", Skill: SkillPass, MetricValue: 2, Timestamp: time.Now()},
+		{EventID: "poison-3", TalentID: "talent-3", Skill: SkillPass, MetricValue: 3, Timestamp: time.Now()},
+		{EventID: "event-1", TalentID: "talent-4", Skill: SkillPass, MetricValue: 50, Timestamp: time.Now()},
+	}
+	for _, event := range events {
+		_, err := service.SaveScoreEvent(ctx, event)
+		require.NoError(t, err)
+	}
+
+	// With a batch of 2, the poison events fill every batch until they're dead-lettered
+	go service.ProcessScoreEvents(ctx, 2)
+
+	t.Run("exhausted events are dead-lettered and don't starve newer ones", func(t *testing.T) {
+		require.EventuallyWithT(t, func(c *assert.CollectT) {
+			status, err := service.GetScoreEventStatus(ctx, "event-1")
+			require.NoError(c, err)
+			assert.Equal(c, ScoreEventProcessed, status.State)
+
+			_, total, err := service.ListDeadLetters(ctx, 0, 10)
+			require.NoError(c, err)
+			assert.Equal(c, 3, total)
+		}, 3*time.Second, 20*time.Millisecond)
+
+		deadLetters, total, err := service.ListDeadLetters(ctx, 0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		require.Len(t, deadLetters, 3)
+		for _, status := range deadLetters {
+			assert.Equal(t, ScoreEventDeadLettered, status.State)
+			assert.Equal(t, 3, status.Attempts)
+			assert.Equal(t, "poisoned metric", status.LastError)
+			assert.False(t, status.DeadLetteredAt.IsZero())
+		}
+
+		page, _, err := service.ListDeadLetters(ctx, 2, 10)
+		require.NoError(t, err)
+		assert.Len(t, page, 1)
+
+		status, err := service.GetDeadLetter(ctx, "poison-1")
+		require.NoError(t, err)
+		assert.Equal(t, events[0], status.Event)
+
+		_, err = service.GetDeadLetter(ctx, "event-1")
+		assert.ErrorIs(t, err, ErrScoreEventNotFound)
+	})
+
+	t.Run("requeued events get new attempts", func(t *testing.T) {
+		scorer.cure(1)
+
+		requeued, err := service.RequeueDeadLetters(ctx, []string{"poison-1", "event-1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"poison-1"}, requeued)
+
+		require.EventuallyWithT(t, func(c *assert.CollectT) {
+			status, err := service.GetScoreEventStatus(ctx, "poison-1")
+			require.NoError(c, err)
+			assert.Equal(c, ScoreEventProcessed, status.State)
+			assert.Equal(c, 1, status.Attempts)
+		}, 2*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("purged events are deleted but still deduplicated", func(t *testing.T) {
+		// No events is not all of them
+		purged, err := service.PurgeDeadLetters(ctx, []string{})
+		require.NoError(t, err)
+		assert.Empty(t, purged)
+
+		purged, err = service.PurgeAllDeadLetters(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"poison-2", "poison-3"}, purged)
+
+		_, total, err := service.ListDeadLetters(ctx, 0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 0, total)
+
+		_, err = service.GetScoreEventStatus(ctx, "poison-2")
+		assert.ErrorIs(t, err, ErrScoreEventNotFound)
+
+		saved, err := service.SaveScoreEvent(ctx, events[1])
+		require.NoError(t, err)
+		assert.False(t, saved)
+	})
+}
+
+func TestService_RetryBackoff(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	storage := NewInMemStorageWithOptions(InMemStorageOptions{
+		MaxAttempts: 3,
+		Retry:       RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute},
+		Now:         func() time.Time { return now },
+	})
+	service := NewServiceWithOptions(storage, &poisonScorer{poisoned: map[int]bool{1: true}}, ServiceOptions{WorkerID: "worker-1"})
+	ctx := context.Background()
+
+	event := ScoreEvent{EventID: "poison-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 1, Timestamp: now}
+	_, err := service.SaveScoreEvent(ctx, event)
+	require.NoError(t, err)
+
+	consume := func() []ScoreEvent {
+		events, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		return events
+	}
+
+	retried := atomic.LoadUint64(&ScoreEventsRetried)
+	deadLettered := atomic.LoadUint64(&ScoreEventsDeadLettered)
+
+	require.Len(t, consume(), 1)
+	service.markScoreEventFailed(ctx, event, fmt.Errorf("poisoned metric"))
+	status, err := service.GetScoreEventStatus(ctx, event.EventID)
+	require.NoError(t, err)
+	assert.Equal(t, ScoreEventFailed, status.State)
+	assert.Equal(t, now.Add(time.Second), status.NextAttemptAt)
+	assert.Empty(t, consume(), "not due before its next attempt")
+
+	now = now.Add(time.Second)
+	assert.Equal(t, []ScoreEvent{event}, consume(), "due at its next attempt")
+
+	service.markScoreEventFailed(ctx, event, fmt.Errorf("poisoned metric"))
+	status, err = service.GetScoreEventStatus(ctx, event.EventID)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(2*time.Second), status.NextAttemptAt, "the delay doubles")
+	now = now.Add(time.Second)
+	assert.Empty(t, consume())
+	now = now.Add(time.Second)
+	assert.Len(t, consume(), 1)
+
+	service.markScoreEventFailed(ctx, event, fmt.Errorf("poisoned metric"))
+	status, err = service.GetScoreEventStatus(ctx, event.EventID)
+	require.NoError(t, err)
+	assert.Equal(t, ScoreEventDeadLettered, status.State)
+	assert.True(t, status.NextAttemptAt.IsZero())
+
+	assert.Equal(t, retried+2, atomic.LoadUint64(&ScoreEventsRetried))
+	assert.Equal(t, deadLettered+1, atomic.LoadUint64(&ScoreEventsDeadLettered))
+
+	_, err = service.RequeueDeadLetters(ctx, []string{event.EventID})
+	require.NoError(t, err)
+	assert.Len(t, consume(), 1, "requeued events are due right away")
+}
+
+// orderCheckingScorer scores metric values encoded as talent*1000+seq, and records how the events of each talent were
+// scored: how many times each metric was scored, whether a talent's events overlapped or came out of order
+type orderCheckingScorer struct {
+	mu         sync.Mutex
+	calls      map[int]int
+	lastSeq    map[int]int
+	inFlight   map[int]bool
+	running    int
+	maxRunning int
+	violations []string
+}
+
+func (s *orderCheckingScorer) CalculateScore(ctx context.Context, skill Skill, metricValue int) (int, error) {
+	talent, seq := metricValue/1000, metricValue%1000
+
+	s.mu.Lock()
+	s.calls[metricValue]++
+	if s.inFlight[talent] {
+		s.violations = append(s.violations, fmt.Sprintf("talent %d scored concurrently", talent))
+	}
+	if seq <= s.lastSeq[talent] {
+		s.violations = append(s.violations, fmt.Sprintf("talent %d scored %d after %d", talent, seq, s.lastSeq[talent]))
+	}
+	s.inFlight[talent] = true
+	s.lastSeq[talent] = seq
+	s.running++
+	s.maxRunning = max(s.maxRunning, s.running)
+	s.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight[talent] = false
+	s.running--
+	return metricValue, nil
+}
+
+func TestService_ProcessScoreEvents_Concurrent(t *testing.T) {
+	const talents, eventsPerTalent = 20, 25
+
+	storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime})
+	scorer := &orderCheckingScorer{calls: map[int]int{}, lastSeq: map[int]int{}, inFlight: map[int]bool{}}
+	service := NewServiceWithOptions(storage, scorer, ServiceOptions{Workers: 8})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Save the events from several clients at once, interleaving the talents
+	var wg sync.WaitGroup
+	for talent := 1; talent <= talents; talent++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seq := 1; seq <= eventsPerTalent; seq++ {
+				event := ScoreEvent{
+					EventID:     fmt.Sprintf("event-%d-%d", talent, seq),
+					TalentID:    TalentID(fmt.Sprintf("talent-%d", talent)),
+					Skill:       SkillPass,
+					MetricValue: talent*1000 + seq,
+					Timestamp:   time.Now(),
+				}
+				_, err := service.SaveScoreEvent(ctx, event)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	// Events are consumed while they're still being saved
+	go service.ProcessScoreEvents(ctx, 50)
+	wg.Wait()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		for talent := 1; talent <= talents; talent++ {
+			status, err := service.GetScoreEventStatus(ctx, fmt.Sprintf("event-%d-%d", talent, eventsPerTalent))
+			require.NoError(c, err)
+			assert.Equal(c, ScoreEventProcessed, status.State)
+		}
+	}, 8*time.Second, 20*time.Millisecond)
+
+	scorer.mu.Lock()
+	defer scorer.mu.Unlock()
+	assert.Empty(t, scorer.violations)
+	assert.Greater(t, scorer.maxRunning, 1, "events are scored in parallel")
+	assert.Len(t, scorer.calls, talents*eventsPerTalent, "no event is lost")
+	for metricValue, calls := range scorer.calls {
+		assert.Equal(t, 1, calls, "metric %d is scored once", metricValue)
+	}
+
+	for talent := 1; talent <= talents; talent++ {
+		talentID := TalentID(fmt.Sprintf("talent-%d", talent))
+		for seq := 1; seq <= eventsPerTalent; seq++ {
+			status, err := service.GetScoreEventStatus(ctx, fmt.Sprintf("event-%d-%d", talent, seq))
+			require.NoError(t, err)
+			assert.Equal(t, ScoreEventProcessed, status.State)
+			assert.Equal(t, 1, status.Attempts)
+		}
+		profile, err := service.GetTalentProfile(ctx, talentID)
+		require.NoError(t, err)
+		assert.Equal(t, eventsPerTalent, profile.ScoreCount, "%s has a score per event", talentID)
+		assert.Equal(t, talent*1000+eventsPerTalent, profile.Bests[SkillPass].Score)
+	}
+}
+
+// orderRecordingScorer fails the first attempt of the metric values in failOnce, and records the order of the attempts
+type orderRecordingScorer struct {
+	mu       sync.Mutex
+	failOnce map[int]bool
+	attempts []int
+}
+
+func (s *orderRecordingScorer) CalculateScore(ctx context.Context, skill Skill, metricValue int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts = append(s.attempts, metricValue)
+	if s.failOnce[metricValue] {
+		delete(s.failOnce, metricValue)
+		return 0, fmt.Errorf("scorer unavailable")
+	}
+	return metricValue, nil
+}
+
+func TestService_ProcessScoreEvents_FailureOrder(t *testing.T) {
+	t.Run("later events of a talent are scored after its failed event", func(t *testing.T) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime, Aggregator: LatestAggregator{}})
+		scorer := &orderRecordingScorer{failOnce: map[int]bool{1: true}}
+		service := NewServiceWithOptions(storage, scorer, ServiceOptions{Workers: 2})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		ts := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		for i, talentID := range []TalentID{"talent-1", "talent-1", "talent-2"} {
+			event := ScoreEvent{EventID: fmt.Sprintf("event-%d", i+1), TalentID: talentID, Skill: SkillPass, MetricValue: i + 1, Timestamp: ts}
+			_, err := service.SaveScoreEvent(ctx, event)
+			require.NoError(t, err)
+		}
+		go service.ProcessScoreEvents(ctx, 10)
+
+		require.EventuallyWithT(t, func(c *assert.CollectT) {
+			for _, eventID := range []string{"event-1", "event-2", "event-3"} {
+				status, err := service.GetScoreEventStatus(ctx, eventID)
+				require.NoError(c, err)
+				assert.Equal(c, ScoreEventProcessed, status.State)
+			}
+		}, 4*time.Second, 10*time.Millisecond)
+
+		scorer.mu.Lock()
+		var talent1Attempts []int
+		for _, metricValue := range scorer.attempts {
+			if metricValue != 3 {
+				talent1Attempts = append(talent1Attempts, metricValue)
+			}
+		}
+		scorer.mu.Unlock()
+		assert.Equal(t, []int{1, 1, 2}, talent1Attempts)
+
+		talent, err := service.GetTalentRank(ctx, LeaderboardKey{}, "talent-1")
+		require.NoError(t, err)
+		assert.Equal(t, 2, talent.TalentScore.Score, "the latest event is the latest score")
+	})
+
+	t.Run("later events of a talent aren't claimed before its failed event is due", func(t *testing.T) {
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{
+			Retry: RetryPolicy{BaseDelay: time.Minute},
+			Now:   func() time.Time { return now },
+		})
+		scorer := &orderRecordingScorer{failOnce: map[int]bool{1: true}}
+		service := NewServiceWithOptions(storage, scorer, ServiceOptions{WorkerID: "worker-1"})
+		ctx := context.Background()
+
+		var events []ScoreEvent
+		for i, talentID := range []TalentID{"talent-1", "talent-1", "talent-2", "talent-1"} {
+			event := ScoreEvent{EventID: fmt.Sprintf("event-%d", i+1), TalentID: talentID, Skill: SkillPass, MetricValue: i + 1, Timestamp: now}
+			_, err := service.SaveScoreEvent(ctx, event)
+			require.NoError(t, err)
+			events = append(events, event)
+		}
+		consume := func() []ScoreEvent {
+			claimed, err := storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+			require.NoError(t, err)
+			return claimed
+		}
+
+		processed := service.processScoreEvents(ctx, consume())
+		assert.Equal(t, []ScoreEvent{events[2]}, processed)
+		for _, eventID := range []string{"event-2", "event-4"} {
+			status, err := service.GetScoreEventStatus(ctx, eventID)
+			require.NoError(t, err)
+			assert.Equal(t, ScoreEventPending, status.State)
+			assert.Empty(t, status.LeasedBy, "%s is released", eventID)
+			assert.Zero(t, status.Attempts)
+		}
+		require.NoError(t, storage.MarkScoreEventsAsProcessed(ctx, "worker-1", processed))
+
+		assert.Empty(t, consume(), "talent-1 waits for event-1")
+
+		now = now.Add(time.Minute)
+		claimed := consume()
+		assert.Equal(t, []ScoreEvent{events[0], events[1], events[3]}, claimed)
+		assert.Equal(t, claimed, service.processScoreEvents(ctx, claimed))
+	})
+}
+
+func TestService_Leases(t *testing.T) {
+	// setup saves event-1 to event-4, and returns a func that moves the storage's clock forward
+	setup := func(t *testing.T) (*InMemStorage, []ScoreEvent, func(time.Duration)) {
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{
+			LeaderboardMode: LeaderboardModeRealtime,
+			LeaseTimeout:    time.Minute,
+			Now:             func() time.Time { return now },
+		})
+		var events []ScoreEvent
+		for i := 1; i <= 4; i++ {
+			event := ScoreEvent{EventID: fmt.Sprintf("event-%d", i), TalentID: TalentID(fmt.Sprintf("talent-%d", i)), Skill: SkillPass, MetricValue: i * 10, Timestamp: now}
+			_, err := storage.SaveScoreEvent(context.Background(), event)
+			require.NoError(t, err)
+			events = append(events, event)
+		}
+		return storage, events, func(d time.Duration) { now = now.Add(d) }
+	}
+
+	t.Run("competing workers claim different events", func(t *testing.T) {
+		storage, events, _ := setup(t)
+		ctx := context.Background()
+
+		claimed, err := storage.ConsumeScoreEvents(ctx, "worker-1", 2)
+		require.NoError(t, err)
+		assert.Equal(t, events[:2], claimed)
+		claimed, err = storage.ConsumeScoreEvents(ctx, "worker-2", 10)
+		require.NoError(t, err)
+		assert.Equal(t, events[2:], claimed)
+		claimed, err = storage.ConsumeScoreEvents(ctx, "worker-2", 10)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+
+		status, _, err := storage.GetScoreEventStatus(ctx, "event-1")
+		require.NoError(t, err)
+		assert.Equal(t, "worker-1", status.LeasedBy)
+		assert.Equal(t, time.Date(2025, 1, 1, 12, 1, 0, 0, time.UTC), status.LeaseExpiresAt)
+	})
+
+	t.Run("only the lease holder reports the outcome", func(t *testing.T) {
+		storage, events, _ := setup(t)
+		ctx := context.Background()
+
+		_, err := storage.ConsumeScoreEvents(ctx, "worker-1", 2)
+		require.NoError(t, err)
+
+		err = storage.MarkScoreEventsAsProcessed(ctx, "worker-2", events[:1])
+		assert.ErrorIs(t, err, ErrLeaseNotHeld)
+		err = storage.MarkScoreEventFailed(ctx, "worker-2", events[1], fmt.Errorf("scorer unavailable"))
+		assert.ErrorIs(t, err, ErrLeaseNotHeld)
+		for _, event := range events[:2] {
+			status, _, err := storage.GetScoreEventStatus(ctx, event.EventID)
+			require.NoError(t, err)
+			assert.Equal(t, ScoreEventPending, status.State)
+		}
+
+		// The events leased to the worker are marked even if others aren't
+		err = storage.MarkScoreEventsAsProcessed(ctx, "worker-1", events[:3])
+		assert.ErrorIs(t, err, ErrLeaseNotHeld)
+		assert.ErrorContains(t, err, "event-3")
+		for i, state := range []ScoreEventState{ScoreEventProcessed, ScoreEventProcessed, ScoreEventPending} {
+			status, _, err := storage.GetScoreEventStatus(ctx, events[i].EventID)
+			require.NoError(t, err)
+			assert.Equal(t, state, status.State, events[i].EventID)
+			assert.Empty(t, status.LeasedBy)
+		}
+	})
+
+	t.Run("expired leases can be claimed by another worker", func(t *testing.T) {
+		storage, events, advance := setup(t)
+		ctx := context.Background()
+
+		_, err := storage.ConsumeScoreEvents(ctx, "worker-1", 1)
+		require.NoError(t, err)
+		advance(30 * time.Second)
+		claimed, err := storage.ConsumeScoreEvents(ctx, "worker-2", 1)
+		require.NoError(t, err)
+		assert.Equal(t, events[1:2], claimed, "the lease hasn't expired yet")
+
+		advance(time.Minute)
+		claimed, err = storage.ConsumeScoreEvents(ctx, "worker-2", 1)
+		require.NoError(t, err)
+		require.Equal(t, events[:1], claimed)
+
+		// worker-1 finishes scoring after its lease was taken over
+		score := TalentScore{TalentID: "talent-1", Skill: SkillPass, Score: 10, EventID: "event-1"}
+		require.NoError(t, storage.SaveTalentScore(ctx, score))
+		err = storage.MarkScoreEventsAsProcessed(ctx, "worker-1", events[:1])
+		assert.ErrorIs(t, err, ErrLeaseNotHeld)
+
+		require.NoError(t, storage.SaveTalentScore(ctx, score))
+		require.NoError(t, storage.MarkScoreEventsAsProcessed(ctx, "worker-2", events[:1]))
+
+		status, _, err := storage.GetScoreEventStatus(ctx, "event-1")
+		require.NoError(t, err)
+		assert.Equal(t, ScoreEventProcessed, status.State)
+		assert.Equal(t, 1, status.Attempts)
+		profile, _, err := storage.GetTalentProfile(ctx, "talent-1")
+		require.NoError(t, err)
+		assert.Equal(t, 1, profile.ScoreCount, "the event is scored once")
+	})
+
+	t.Run("an expired lease is held until another worker claims the event", func(t *testing.T) {
+		storage, events, advance := setup(t)
+		ctx := context.Background()
+
+		_, err := storage.ConsumeScoreEvents(ctx, "worker-1", 1)
+		require.NoError(t, err)
+		advance(2 * time.Minute)
+		require.NoError(t, storage.MarkScoreEventFailed(ctx, "worker-1", events[0], fmt.Errorf("scorer timed out")))
+
+		status, _, err := storage.GetScoreEventStatus(ctx, "event-1")
+		require.NoError(t, err)
+		assert.Equal(t, ScoreEventFailed, status.State)
+		assert.Empty(t, status.LeasedBy)
+		assert.True(t, status.LeaseExpiresAt.IsZero())
+	})
+}
+
+func TestService_Outbox(t *testing.T) {
+	storage := NewInMemStorageWithOptions(InMemStorageOptions{MaxAttempts: 1, LeaseTimeout: time.Minute})
+	ctx := context.Background()
+
+	var events []ScoreEvent
+	for i := 1; i <= 100; i++ {
+		event := ScoreEvent{EventID: fmt.Sprintf("event-%d", i), TalentID: TalentID(fmt.Sprintf("talent-%d", i)), Skill: SkillPass, MetricValue: i}
+		_, err := storage.SaveScoreEvent(ctx, event)
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+	consume := func(limit int) []ScoreEvent {
+		claimed, err := storage.ConsumeScoreEvents(ctx, "worker-1", limit)
+		require.NoError(t, err)
+		return claimed
+	}
+	outbox := func() []string {
+		storage.scoreEventsMu.RLock()
+		defer storage.scoreEventsMu.RUnlock()
+		var eventIDs []string
+		for _, status := range storage.outbox {
+			eventIDs = append(eventIDs, status.Event.EventID)
+		}
+		return eventIDs
+	}
+
+	t.Run("processed events leave the outbox", func(t *testing.T) {
+		claimed := consume(98)
+		require.Equal(t, events[:98], claimed)
+		require.NoError(t, storage.MarkScoreEventsAsProcessed(ctx, "worker-1", claimed[:97]))
+
+		// event-98 is still leased, so it's kept, and the scan stops at the limit
+		assert.Equal(t, events[98:99], consume(1))
+		assert.Equal(t, []string{"event-98", "event-99", "event-100"}, outbox())
+	})
+
+	t.Run("dead letters leave the outbox and come back at its end when requeued", func(t *testing.T) {
+		require.NoError(t, storage.MarkScoreEventFailed(ctx, "worker-1", events[97], fmt.Errorf("poisoned metric")))
+		require.NoError(t, storage.MarkScoreEventsAsProcessed(ctx, "worker-1", events[98:99]))
+		assert.Equal(t, events[99:], consume(10))
+		assert.Equal(t, []string{"event-100"}, outbox())
+
+		_, err := storage.RequeueDeadLetters(ctx, []string{"event-98"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"event-100", "event-98"}, outbox())
+		assert.Equal(t, events[97:98], consume(10))
+	})
+
+	t.Run("a dead letter requeued before it left the outbox isn't added twice", func(t *testing.T) {
+		require.NoError(t, storage.MarkScoreEventFailed(ctx, "worker-1", events[97], fmt.Errorf("poisoned metric")))
+		_, err := storage.RequeueDeadLetters(ctx, []string{"event-98"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"event-100", "event-98"}, outbox())
+		assert.Equal(t, events[97:98], consume(10))
+	})
+}
+
+// consumeCountingStorage counts the ConsumeScoreEvents calls
+type consumeCountingStorage struct {
+	*InMemStorage
+	consumes atomic.Int64
+}
+
+func (s *consumeCountingStorage) ConsumeScoreEvents(ctx context.Context, workerID string, limit int) ([]ScoreEvent, error) {
+	s.consumes.Add(1)
+	return s.InMemStorage.ConsumeScoreEvents(ctx, workerID, limit)
+}
+
+func TestService_ProcessScoreEvents_Wakeup(t *testing.T) {
+	t.Run("saved and requeued events close the notify channel", func(t *testing.T) {
+		storage := NewInMemStorageWithOptions(InMemStorageOptions{MaxAttempts: 1})
+		ctx := context.Background()
+		closed := func(notify <-chan struct{}) bool {
+			select {
+			case <-notify:
+				return true
+			default:
+				return false
+			}
+		}
+
+		notify := storage.ScoreEventsNotify()
+		assert.False(t, closed(notify))
+		event := ScoreEvent{EventID: "event-1", TalentID: "talent-1", Skill: SkillPass, MetricValue: 10}
+		_, err := storage.SaveScoreEvent(ctx, event)
+		require.NoError(t, err)
+		assert.True(t, closed(notify))
+
+		notify = storage.ScoreEventsNotify()
+		_, err = storage.SaveScoreEvent(ctx, event)
+		require.NoError(t, err)
+		_, err = storage.ConsumeScoreEvents(ctx, "worker-1", 10)
+		require.NoError(t, err)
+		require.NoError(t, storage.MarkScoreEventFailed(ctx, "worker-1", event, fmt.Errorf("poisoned metric")))
+		assert.False(t, closed(notify), "duplicates and failures aren't new work")
+
+		_, err = storage.RequeueAllDeadLetters(ctx)
+		require.NoError(t, err)
+		assert.True(t, closed(notify))
+	})
+
+	t.Run("an idle worker sleeps until new events are saved", func(t *testing.T) {
+		storage := &consumeCountingStorage{InMemStorage: NewInMemStorageWithOptions(InMemStorageOptions{LeaderboardMode: LeaderboardModeRealtime})}
+		service := NewServiceWithOptions(storage, NewLinearScorer(), ServiceOptions{
+			IdleBackoff: RetryPolicy{BaseDelay: time.Hour},
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go service.ProcessScoreEvents(ctx, 10)
+		time.Sleep(200 * time.Millisecond)
+		assert.Equal(t, int64(1), storage.consumes.Load(), "an idle worker doesn't poll")
+
+		for i := 1; i <= 3; i++ {
+			event := ScoreEvent{EventID: fmt.Sprintf("event-%d", i), TalentID: "talent-1", Skill: SkillPass, MetricValue: i * 10, Timestamp: time.Now()}
+			_, err := service.SaveScoreEvent(ctx, event)
+			require.NoError(t, err)
+
+			require.EventuallyWithT(t, func(c *assert.CollectT) {
+				status, err := service.GetScoreEventStatus(ctx, event.EventID)
+				require.NoError(c, err)
+				assert.Equal(c, ScoreEventProcessed, status.State)
+			}, time.Second, 5*time.Millisecond, "the worker is woken up long before its hour of backoff")
+		}
+	})
+}
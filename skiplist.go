@@ -0,0 +1,190 @@
+package main
+
+import "math/rand/v2"
+
+const (
+	skiplistMaxLevel = 32
+	// skiplistP is the probability of a node being promoted to the next level
+	skiplistP = 0.25
+)
+
+// skiplist is an ordered set with O(log n) insert, delete and lookup by position.
+// Every link stores its span (the number of nodes it skips), which makes it an order-statistic structure
+// similar to the one Redis uses for sorted sets.
+// It's not safe for concurrent use.
+type skiplist[T any] struct {
+	head   *skiplistNode[T]
+	level  int
+	length int
+	less   func(a, b T) bool
+}
+
+type skiplistNode[T any] struct {
+	value T
+	next  []skiplistLink[T]
+}
+
+type skiplistLink[T any] struct {
+	node *skiplistNode[T]
+	span int
+}
+
+// newSkiplist creates an empty skiplist ordered by less. less must define a strict total order.
+func newSkiplist[T any](less func(a, b T) bool) *skiplist[T] {
+	return &skiplist[T]{
+		head:  &skiplistNode[T]{next: make([]skiplistLink[T], skiplistMaxLevel)},
+		level: 1,
+		less:  less,
+	}
+}
+
+func (sl *skiplist[T]) Len() int {
+	return sl.length
+}
+
+// Insert adds the value. Inserting a value that's already in the list adds a second copy.
+func (sl *skiplist[T]) Insert(value T) {
+	var update [skiplistMaxLevel]*skiplistNode[T]
+	var rank [skiplistMaxLevel]int
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i].node != nil && sl.less(x.next[i].node.value, value) {
+			rank[i] += x.next[i].span
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+
+	level := randomSkiplistLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.head
+			update[i].next[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	node := &skiplistNode[T]{value: value, next: make([]skiplistLink[T], level)}
+	for i := 0; i < level; i++ {
+		node.next[i].node = update[i].next[i].node
+		update[i].next[i].node = node
+
+		node.next[i].span = update[i].next[i].span - (rank[0] - rank[i])
+		update[i].next[i].span = rank[0] - rank[i] + 1
+	}
+
+	// The new node is below the higher levels, so the links jumping over it get longer
+	for i := level; i < sl.level; i++ {
+		update[i].next[i].span++
+	}
+
+	sl.length++
+}
+
+// Delete removes the value and reports whether it was found
+func (sl *skiplist[T]) Delete(value T) bool {
+	var update [skiplistMaxLevel]*skiplistNode[T]
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && sl.less(x.next[i].node.value, value) {
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+
+	x = x.next[0].node
+	if x == nil || sl.less(value, x.value) {
+		return false
+	}
+
+	for i := 0; i < sl.level; i++ {
+		if update[i].next[i].node == x {
+			update[i].next[i].span += x.next[i].span - 1
+			update[i].next[i].node = x.next[i].node
+		} else {
+			update[i].next[i].span--
+		}
+	}
+	for sl.level > 1 && sl.head.next[sl.level-1].node == nil {
+		sl.level--
+	}
+
+	sl.length--
+	return true
+}
+
+// LowerBound returns the number of values that are less than the given value,
+// which is the 0-based position the value has (or would have) in the list.
+func (sl *skiplist[T]) LowerBound(value T) int {
+	position := 0
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && sl.less(x.next[i].node.value, value) {
+			position += x.next[i].span
+			x = x.next[i].node
+		}
+	}
+
+	return position
+}
+
+// UpperBound returns the number of values that are not greater than the given value,
+// which is the 0-based position of the first value after it.
+func (sl *skiplist[T]) UpperBound(value T) int {
+	position := 0
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && !sl.less(value, x.next[i].node.value) {
+			position += x.next[i].span
+			x = x.next[i].node
+		}
+	}
+
+	return position
+}
+
+// Range returns up to limit values starting from the 0-based position offset
+func (sl *skiplist[T]) Range(offset, limit int) []T {
+	if offset < 0 || offset >= sl.length || limit <= 0 {
+		return nil
+	}
+	if limit > sl.length-offset {
+		limit = sl.length - offset
+	}
+
+	// Find the node at the offset by its 1-based rank, then walk the bottom level
+	target := offset + 1
+	traversed := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && traversed+x.next[i].span <= target {
+			traversed += x.next[i].span
+			x = x.next[i].node
+		}
+		if traversed == target {
+			break
+		}
+	}
+
+	values := make([]T, 0, limit)
+	for ; x != nil && len(values) < limit; x = x.next[0].node {
+		values = append(values, x.value)
+	}
+	return values
+}
+
+func randomSkiplistLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkiplist(t *testing.T) {
+	t.Run("keeps order and positions under random inserts and deletes", func(t *testing.T) {
+		list := newSkiplist(func(a, b int) bool { return a < b })
+		present := map[int]bool{}
+
+		for i := 0; i < 5000; i++ {
+			value := rand.IntN(1000)
+			if present[value] {
+				require.True(t, list.Delete(value))
+				delete(present, value)
+			} else {
+				list.Insert(value)
+				present[value] = true
+			}
+		}
+
+		expected := make([]int, 0, len(present))
+		for value := range present {
+			expected = append(expected, value)
+		}
+		sort.Ints(expected)
+
+		require.Equal(t, len(expected), list.Len())
+		assert.Equal(t, expected, list.Range(0, len(expected)))
+		for i, value := range expected {
+			assert.Equal(t, i, list.LowerBound(value))
+			assert.Equal(t, i+1, list.UpperBound(value))
+		}
+		assert.Equal(t, expected[10:20], list.Range(10, 10))
+		assert.False(t, list.Delete(-1))
+	})
+}
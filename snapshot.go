@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+var ErrSnapshotCorrupted = errors.New("snapshot is corrupted")
+
+// SnapshotInfo describes a stored snapshot.
+// ID is the LSN of the last log record included in the snapshot.
+type SnapshotInfo struct {
+	ID        uint64    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+}
+
+// snapshotFile is the on-disk format of a snapshot. Checksum is the crc32 of State.
+type snapshotFile struct {
+	ID        uint64          `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Checksum  uint32          `json:"checksum"`
+	State     json.RawMessage `json:"state"`
+}
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotExt    = ".json"
+)
+
+// snapshotStore keeps snapshot files in a directory, one file per snapshot.
+type snapshotStore struct {
+	dir string
+}
+
+func newSnapshotStore(dir string) (*snapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create snapshot dir: %w", err)
+	}
+	return &snapshotStore{dir: dir}, nil
+}
+
+// write stores the snapshot atomically: it's written to a temp file first and renamed once fsynced.
+func (ss *snapshotStore) write(id uint64, state storageState) (SnapshotInfo, error) {
+	rawState, err := json.Marshal(state)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("marshal snapshot state: %w", err)
+	}
+
+	snapshot := snapshotFile{
+		ID:        id,
+		CreatedAt: time.Now().UTC(),
+		Checksum:  crc32.ChecksumIEEE(rawState),
+		State:     rawState,
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("marshal snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(ss.dir, "tmp-"+snapshotPrefix+"*")
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return SnapshotInfo{}, fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return SnapshotInfo{}, fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), ss.path(id)); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("rename snapshot: %w", err)
+	}
+	if err := syncDir(ss.dir); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	return SnapshotInfo{ID: id, CreatedAt: snapshot.CreatedAt, Size: int64(len(data))}, nil
+}
+
+// read loads the snapshot and verifies its checksum
+func (ss *snapshotStore) read(id uint64) (storageState, SnapshotInfo, error) {
+	data, err := os.ReadFile(ss.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return storageState{}, SnapshotInfo{}, fmt.Errorf("%w: %d", ErrSnapshotNotFound, id)
+	}
+	if err != nil {
+		return storageState{}, SnapshotInfo{}, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snapshot snapshotFile
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return storageState{}, SnapshotInfo{}, fmt.Errorf("%w: %d: %v", ErrSnapshotCorrupted, id, err)
+	}
+	if snapshot.ID != id {
+		return storageState{}, SnapshotInfo{}, fmt.Errorf("%w: %d: file contains snapshot %d", ErrSnapshotCorrupted, id, snapshot.ID)
+	}
+	if crc32.ChecksumIEEE(snapshot.State) != snapshot.Checksum {
+		return storageState{}, SnapshotInfo{}, fmt.Errorf("%w: %d: checksum mismatch", ErrSnapshotCorrupted, id)
+	}
+
+	var state storageState
+	if err := json.Unmarshal(snapshot.State, &state); err != nil {
+		return storageState{}, SnapshotInfo{}, fmt.Errorf("%w: %d: %v", ErrSnapshotCorrupted, id, err)
+	}
+
+	return state, SnapshotInfo{ID: id, CreatedAt: snapshot.CreatedAt, Size: int64(len(data))}, nil
+}
+
+// list returns all snapshots ordered by ID, oldest first. CreatedAt is the file modification time.
+func (ss *snapshotStore) list() ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(ss.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot dir: %w", err)
+	}
+
+	var snapshots []SnapshotInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("stat snapshot: %w", err)
+		}
+		snapshots = append(snapshots, SnapshotInfo{ID: id, CreatedAt: info.ModTime().UTC(), Size: info.Size()})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID < snapshots[j].ID })
+	return snapshots, nil
+}
+
+func (ss *snapshotStore) exists(id uint64) bool {
+	_, err := os.Stat(ss.path(id))
+	return err == nil
+}
+
+func (ss *snapshotStore) remove(id uint64) error {
+	if err := os.Remove(ss.path(id)); err != nil {
+		return fmt.Errorf("remove snapshot: %w", err)
+	}
+	return nil
+}
+
+func (ss *snapshotStore) path(id uint64) string {
+	return filepath.Join(ss.dir, fmt.Sprintf("%s%020d%s", snapshotPrefix, id, snapshotExt))
+}
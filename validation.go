@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldViolation is a single broken rule of an incoming event
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rule an incoming event breaks
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Field + ": " + violation.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// MalformedEventError is returned for a body that's not a JSON object of the expected types
+type MalformedEventError struct {
+	Err error
+}
+
+func (e *MalformedEventError) Error() string {
+	return "invalid JSON: " + e.Err.Error()
+}
+
+func (e *MalformedEventError) Unwrap() error {
+	return e.Err
+}
+
+// MetricRange is the inclusive range of raw metric values of a skill
+type MetricRange struct {
+	Min, Max int
+}
+
+// DefaultMetricRange applies to skills without a configured range
+var DefaultMetricRange = MetricRange{Min: 0, Max: 1_000_000}
+
+// DefaultIDPattern allows IDs of up to 128 letters, digits, and . _ : - characters
+var DefaultIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type ValidationRules struct {
+	// IDPattern is the format of event and talent IDs (default is DefaultIDPattern)
+	IDPattern *regexp.Regexp
+	// MetricRanges is the range of raw metric values per skill. Skills without a range use DefaultMetricRange.
+	MetricRanges map[Skill]MetricRange
+	// MaxFutureSkew is how far ahead of the server clock an event timestamp may be, to tolerate client clock skew
+	// (default is 5 minutes)
+	MaxFutureSkew time.Duration
+	// MaxEventAge is how old an event timestamp may be. Zero allows any age, which backfills need.
+	MaxEventAge time.Duration
+	// StrictJSON rejects unknown fields
+	StrictJSON bool
+	// Now returns the current time, it's time.Now by default
+	Now func() time.Time
+}
+
+// EventValidator checks incoming events against the validation rules.
+// It's used by every ingestion path, so single, batch and streamed events are held to the same rules.
+type EventValidator struct {
+	rules ValidationRules
+}
+
+func NewEventValidator(rules ValidationRules) *EventValidator {
+	if rules.IDPattern == nil {
+		rules.IDPattern = DefaultIDPattern
+	}
+	if rules.MaxFutureSkew == 0 {
+		rules.MaxFutureSkew = 5 * time.Minute
+	}
+	if rules.Now == nil {
+		rules.Now = time.Now
+	}
+	return &EventValidator{rules: rules}
+}
+
+// Parse decodes and validates a single event.
+// Returns a *MalformedEventError if the JSON can't be decoded, and a *ValidationError listing all violations otherwise.
+// The decoded event is returned even if it's invalid, so the caller can tell which event was rejected.
+func (v *EventValidator) Parse(data []byte) (ScoreEvent, error) {
+	var req CreateEventRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return ScoreEvent{}, &MalformedEventError{Err: err}
+	}
+
+	event := ScoreEvent{
+		EventID:     req.EventID,
+		TalentID:    TalentID(req.TalentID),
+		Skill:       Skill(req.Skill),
+		MetricValue: req.RawMetric,
+		Timestamp:   req.Timestamp,
+	}
+
+	var violations []FieldViolation
+	if v.rules.StrictJSON {
+		violations = unknownFieldViolations(data)
+	}
+	violations = append(violations, v.violations(event)...)
+	if len(violations) > 0 {
+		return event, &ValidationError{Violations: violations}
+	}
+	return event, nil
+}
+
+// Validate checks an already decoded event, returns a *ValidationError listing all violations
+func (v *EventValidator) Validate(event ScoreEvent) error {
+	if violations := v.violations(event); len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func (v *EventValidator) violations(event ScoreEvent) []FieldViolation {
+	var violations []FieldViolation
+	add := func(field, format string, args ...any) {
+		violations = append(violations, FieldViolation{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !v.rules.IDPattern.MatchString(event.EventID) {
+		add("event_id", "must match %s", v.rules.IDPattern)
+	}
+	if !v.rules.IDPattern.MatchString(string(event.TalentID)) {
+		add("talent_id", "must match %s", v.rules.IDPattern)
+	}
+
+	if !event.Skill.IsValid() {
+		add("skill", "must be one of: dribble, shoot, pass")
+	} else if r := v.metricRange(event.Skill); event.MetricValue < r.Min || event.MetricValue > r.Max {
+		add("raw_metric", "must be between %d and %d for %s", r.Min, r.Max, event.Skill)
+	}
+
+	now := v.rules.Now()
+	switch {
+	case event.Timestamp.IsZero():
+		add("ts", "is required")
+	case event.Timestamp.After(now.Add(v.rules.MaxFutureSkew)):
+		add("ts", "must not be more than %s in the future", v.rules.MaxFutureSkew)
+	case v.rules.MaxEventAge > 0 && event.Timestamp.Before(now.Add(-v.rules.MaxEventAge)):
+		add("ts", "must not be more than %s in the past", v.rules.MaxEventAge)
+	}
+
+	return violations
+}
+
+func (v *EventValidator) metricRange(skill Skill) MetricRange {
+	if r, ok := v.rules.MetricRanges[skill]; ok {
+		return r
+	}
+	return DefaultMetricRange
+}
+
+// unknownFieldViolations lists the fields of the object that CreateEventRequest doesn't have.
+// Unlike json.Decoder.DisallowUnknownFields, it reports all of them rather than the first one.
+func unknownFieldViolations(data []byte) []FieldViolation {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&fields); err != nil {
+		return nil
+	}
+
+	var unknown []string
+	for name := range fields {
+		switch name {
+		case "event_id", "talent_id", "raw_metric", "skill", "ts":
+		default:
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	violations := make([]FieldViolation, len(unknown))
+	for i, name := range unknown {
+		violations[i] = FieldViolation{Field: name, Message: "unknown field"}
+	}
+	return violations
+}
+
+// ParseMetricRanges parses ranges in the "dribble=0-1000,shoot=0-500" format
+func ParseMetricRanges(s string) (map[Skill]MetricRange, error) {
+	ranges := make(map[Skill]MetricRange)
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid metric range %q, must be skill=min-max", pair)
+		}
+		skill := Skill(name)
+		if !skill.IsValid() {
+			return nil, fmt.Errorf("invalid skill %q in metric ranges", name)
+		}
+		minStr, maxStr, ok := strings.Cut(value, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid metric range %q for skill %s, must be min-max", value, skill)
+		}
+		lo, err := strconv.Atoi(minStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid minimum for skill %s: %w", skill, err)
+		}
+		hi, err := strconv.Atoi(maxStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maximum for skill %s: %w", skill, err)
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("minimum of skill %s is greater than its maximum", skill)
+		}
+		ranges[skill] = MetricRange{Min: lo, Max: hi}
+	}
+	return ranges, nil
+}
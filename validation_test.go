@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventValidator(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	validator := NewEventValidator(ValidationRules{
+		MetricRanges:  map[Skill]MetricRange{SkillDribble: {Min: 0, Max: 100}},
+		MaxFutureSkew: time.Minute,
+		MaxEventAge:   24 * time.Hour,
+		StrictJSON:    true,
+		Now:           func() time.Time { return now },
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		violations []FieldViolation
+	}{
+		{
+			name: "valid event",
+			body: `{"event_id":"event-1","talent_id":"talent-1","raw_metric":50,"skill":"dribble","ts":"2025-01-01T11:00:00Z"}`,
+		},
+		{
+			name: "future timestamp within the skew tolerance",
+			body: `{"event_id":"event-1","talent_id":"talent-1","raw_metric":50,"skill":"dribble","ts":"2025-01-01T12:00:30Z"}`,
+		},
+		{
+			name: "every violation is reported",
+			body: `{"event_id":"event 1","talent_id":"","raw_metric":500,"skill":"dribble","ts":"2025-01-01T12:05:00Z","extra":1,"another":true}`,
+			violations: []FieldViolation{
+				{Field: "another", Message: "unknown field"},
+				{Field: "extra", Message: "unknown field"},
+				{Field: "event_id", Message: "must match " + DefaultIDPattern.String()},
+				{Field: "talent_id", Message: "must match " + DefaultIDPattern.String()},
+				{Field: "raw_metric", Message: "must be between 0 and 100 for dribble"},
+				{Field: "ts", Message: "must not be more than 1m0s in the future"},
+			},
+		},
+		{
+			name: "skills without a range use the default range",
+			body: `{"event_id":"event-1","talent_id":"talent-1","raw_metric":-1,"skill":"shoot","ts":"2025-01-01T11:00:00Z"}`,
+			violations: []FieldViolation{
+				{Field: "raw_metric", Message: "must be between 0 and 1000000 for shoot"},
+			},
+		},
+		{
+			name: "unknown skill and missing timestamp",
+			body: `{"event_id":"event-1","talent_id":"talent-1","raw_metric":50,"skill":"juggle"}`,
+			violations: []FieldViolation{
+				{Field: "skill", Message: "must be one of: dribble, shoot, pass"},
+				{Field: "ts", Message: "is required"},
+			},
+		},
+		{
+			name: "too old timestamp",
+			body: `{"event_id":"event-1","talent_id":"talent-1","raw_metric":50,"skill":"pass","ts":"2024-12-30T12:00:00Z"}`,
+			violations: []FieldViolation{
+				{Field: "ts", Message: "must not be more than 24h0m0s in the past"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validator.Parse([]byte(tt.body))
+			if tt.violations == nil {
+				require.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.violations, validationErr.Violations)
+		})
+	}
+
+	t.Run("malformed JSON", func(t *testing.T) {
+		_, err := validator.Parse([]byte(`{"event_id":`))
+		var malformedErr *MalformedEventError
+		assert.ErrorAs(t, err, &malformedErr)
+
+		_, err = validator.Parse([]byte(`{"raw_metric":"high"}`))
+		assert.ErrorAs(t, err, &malformedErr)
+	})
+
+	t.Run("unknown fields are allowed without strict JSON", func(t *testing.T) {
+		lenient := NewEventValidator(ValidationRules{Now: func() time.Time { return now }})
+		event, err := lenient.Parse([]byte(`{"event_id":"event-1","talent_id":"talent-1","raw_metric":50,"skill":"pass","ts":"2025-01-01T11:00:00Z","extra":1}`))
+		require.NoError(t, err)
+		assert.Equal(t, ScoreEvent{
+			EventID:     "event-1",
+			TalentID:    "talent-1",
+			Skill:       SkillPass,
+			MetricValue: 50,
+			Timestamp:   time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC),
+		}, event)
+	})
+}
+
+func TestParseMetricRanges(t *testing.T) {
+	ranges, err := ParseMetricRanges("dribble=0-1000, shoot=10-500")
+	require.NoError(t, err)
+	assert.Equal(t, map[Skill]MetricRange{
+		SkillDribble: {Min: 0, Max: 1000},
+		SkillShoot:   {Min: 10, Max: 500},
+	}, ranges)
+
+	for _, invalid := range []string{"dribble", "juggle=0-10", "dribble=10", "dribble=a-10", "dribble=10-0"} {
+		_, err := ParseMetricRanges(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
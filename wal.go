@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrWALCorrupted = errors.New("write-ahead log is corrupted")
+
+// SyncPolicy defines when the write-ahead log is fsynced to disk.
+type SyncPolicy string
+
+const (
+	// SyncAlways fsyncs after every append. Slowest, but nothing acknowledged is ever lost.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsyncs in the background every WALOptions.SyncInterval.
+	// A crash can lose the appends of the last interval.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the OS.
+	SyncNever SyncPolicy = "never"
+)
+
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(s); policy {
+	case SyncAlways, SyncInterval, SyncNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown sync policy %q, must be one of: always, interval, never", s)
+}
+
+type walRecordType string
+
+const (
+	walRecordScoreEvent  walRecordType = "score_event"
+	walRecordScoreEvents walRecordType = "score_events"
+	walRecordProcessed   walRecordType = "processed"
+	walRecordFailed      walRecordType = "failed"
+	// walRecordRequeue and walRecordPurge apply to the dead-lettered events in EventIDs
+	walRecordRequeue     walRecordType = "requeue"
+	walRecordPurge       walRecordType = "purge"
+	walRecordTalentScore walRecordType = "talent_score"
+	walRecordCloseSeason walRecordType = "close_season"
+	// walRecordRecordRanks recomputes the ranks at Time, it's only replayed from logs written before walRecordRankPoints
+	walRecordRecordRanks walRecordType = "record_ranks"
+	// walRecordRankPoints adds the rank history points in RankPoints, recorded at Time
+	walRecordRankPoints walRecordType = "rank_points"
+	// walRecordCorrection is a retraction or correction of a score event, with the scores it removes and adds
+	walRecordCorrection walRecordType = "correction"
+	// walRecordRestore replaces the whole state with the snapshot in SnapshotID
+	walRecordRestore walRecordType = "restore"
+)
+
+// walRecord is a single entry of the write-ahead log. Only the field matching the Type is set.
+type walRecord struct {
+	LSN  uint64        `json:"lsn"`
+	Type walRecordType `json:"type"`
+
+	ScoreEvent  *ScoreEvent      `json:"score_event,omitempty"`
+	ScoreEvents []ScoreEvent     `json:"score_events,omitempty"`
+	EventIDs    []string         `json:"event_ids,omitempty"`
+	TalentScore *TalentScore     `json:"talent_score,omitempty"`
+	Correction  *EventCorrection `json:"correction,omitempty"`
+	SnapshotID  uint64           `json:"snapshot_id,omitempty"`
+	Time        *time.Time       `json:"time,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	// DeadLetter is set on a failed record of the last allowed attempt, and Time is when the event was dead-lettered
+	DeadLetter bool `json:"dead_letter,omitempty"`
+	// NextAttemptAt is when the event of a failed record is due again
+	NextAttemptAt *time.Time                              `json:"next_attempt_at,omitempty"`
+	RankPoints    map[Skill]map[TalentID]RankHistoryPoint `json:"rank_points,omitempty"`
+	// RankMode is set on a close season record, it's the mode the final standings were ranked with
+	RankMode RankMode `json:"rank_mode,omitempty"`
+}
+
+type WALOptions struct {
+	SyncPolicy SyncPolicy
+	// SyncInterval is only used with SyncInterval policy (default is 1 second)
+	SyncInterval time.Duration
+	// MaxSegmentBytes is the size after which a new segment file is started (default is 64MB)
+	MaxSegmentBytes int64
+}
+
+const walSegmentExt = ".wal"
+
+// WAL is an append-only log split into segment files.
+// Each segment is named after the LSN of its first record, and every line in a segment is
+// "<crc32 of payload in hex> <json payload>", so torn writes and corruption can be detected on replay.
+type WAL struct {
+	dir  string
+	opts WALOptions
+
+	mu          sync.Mutex
+	file        *os.File
+	segmentSize int64
+	lastLSN     uint64
+	dirty       bool
+	// failed is set once a torn write couldn't be undone, every later append returns it
+	failed error
+	// writeLine writes a record line to the segment, it's replaced in tests to fail writes
+	writeLine func(file *os.File, line string) (int, error)
+
+	stopSync chan struct{}
+	syncDone chan struct{}
+}
+
+// OpenWAL opens the log in dir, creating the directory if needed, and calls replay for every record in LSN order.
+// A partially written record at the end of the last segment is treated as a torn write and truncated.
+func OpenWAL(dir string, opts WALOptions, replay func(walRecord) error) (*WAL, error) {
+	if opts.SyncPolicy == "" {
+		opts.SyncPolicy = SyncAlways
+	}
+	if opts.SyncInterval == 0 {
+		opts.SyncInterval = 1 * time.Second
+	}
+	if opts.MaxSegmentBytes == 0 {
+		opts.MaxSegmentBytes = 64 << 20
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create wal dir: %w", err)
+	}
+
+	w := &WAL{dir: dir, opts: opts, writeLine: (*os.File).WriteString}
+
+	segments, err := w.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, firstLSN := range segments {
+		isLast := i == len(segments)-1
+		if err := w.replaySegment(firstLSN, isLast, replay); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		file, err := os.OpenFile(w.segmentPath(last), os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open wal segment: %w", err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("stat wal segment: %w", err)
+		}
+		w.file = file
+		w.segmentSize = info.Size()
+	}
+
+	if opts.SyncPolicy == SyncInterval {
+		w.stopSync = make(chan struct{})
+		w.syncDone = make(chan struct{})
+		go w.startPeriodicSync()
+	}
+
+	return w, nil
+}
+
+// Append assigns the next LSN to the record and writes it to the current segment.
+func (w *WAL) Append(rec walRecord) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.failed != nil {
+		return 0, w.failed
+	}
+	rec.LSN = w.lastLSN + 1
+
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return 0, fmt.Errorf("marshal wal record: %w", err)
+	}
+	line := fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload)
+
+	if w.file == nil || w.segmentSize >= w.opts.MaxSegmentBytes {
+		if err := w.rollSegment(rec.LSN); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.writeLine(w.file, line)
+	if err != nil {
+		// A partial line left in the middle of the segment would make it unreadable once more records follow,
+		// so the segment is cut back to where the record started
+		if truncErr := w.file.Truncate(w.segmentSize); truncErr != nil {
+			w.failed = fmt.Errorf("wal has a torn record that can't be removed: %w", truncErr)
+		}
+		return 0, fmt.Errorf("write wal record: %w", err)
+	}
+	w.segmentSize += int64(n)
+
+	w.lastLSN = rec.LSN
+
+	switch w.opts.SyncPolicy {
+	case SyncAlways:
+		if err := w.file.Sync(); err != nil {
+			return 0, fmt.Errorf("sync wal: %w", err)
+		}
+	case SyncInterval:
+		w.dirty = true
+	}
+
+	return rec.LSN, nil
+}
+
+// LastLSN returns the LSN of the last appended or replayed record
+func (w *WAL) LastLSN() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastLSN
+}
+
+// SkipTo moves the LSN forward, so the next appended record gets lsn+1.
+// It's used when the state was recovered from a snapshot taken after the last record in the log.
+func (w *WAL) SkipTo(lsn uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if lsn <= w.lastLSN {
+		return nil
+	}
+	w.lastLSN = lsn
+
+	// Segment names must match their first LSN, so the next append starts a new one
+	return w.rollSegment(lsn + 1)
+}
+
+// Roll starts a new segment unless the current one is empty,
+// so that all records appended so far are in segments that can be removed by RemoveSegmentsBefore.
+func (w *WAL) Roll() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil && w.segmentSize == 0 {
+		return nil
+	}
+	return w.rollSegment(w.lastLSN + 1)
+}
+
+// RemoveSegmentsBefore deletes the segments that only contain records with LSN <= lsn.
+// The current segment is never removed.
+func (w *WAL) RemoveSegmentsBefore(lsn uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i+1 < len(segments); i++ {
+		nextFirstLSN := segments[i+1]
+		if nextFirstLSN-1 > lsn {
+			break
+		}
+		if err := os.Remove(w.segmentPath(segments[i])); err != nil {
+			return fmt.Errorf("remove wal segment: %w", err)
+		}
+	}
+
+	return syncDir(w.dir)
+}
+
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.syncLocked()
+}
+
+// Close stops the background sync, flushes the current segment and closes it.
+func (w *WAL) Close() error {
+	if w.stopSync != nil {
+		close(w.stopSync)
+		<-w.syncDone
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *WAL) syncLocked() error {
+	if w.file == nil || !w.dirty && w.opts.SyncPolicy == SyncInterval {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	w.dirty = false
+	return nil
+}
+
+func (w *WAL) startPeriodicSync() {
+	defer close(w.syncDone)
+
+	ticker := time.NewTicker(w.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopSync:
+			return
+		case <-ticker.C:
+			if err := w.Sync(); err != nil {
+				log.Printf("Error syncing wal: %v", err)
+			}
+		}
+	}
+}
+
+// rollSegment closes the current segment and starts a new one beginning at firstLSN
+func (w *WAL) rollSegment(firstLSN uint64) error {
+	if w.file != nil {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("sync wal segment: %w", err)
+		}
+		if err := w.file.Close(); err != nil {
+			return fmt.Errorf("close wal segment: %w", err)
+		}
+		w.file = nil
+	}
+
+	file, err := os.OpenFile(w.segmentPath(firstLSN), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("create wal segment: %w", err)
+	}
+	if err := syncDir(w.dir); err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.segmentSize = 0
+	w.dirty = false
+	return nil
+}
+
+func (w *WAL) replaySegment(firstLSN uint64, isLast bool, replay func(walRecord) error) error {
+	path := w.segmentPath(firstLSN)
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open wal segment: %w", err)
+	}
+	defer file.Close()
+
+	// Earlier segments might have been removed by compaction
+	if w.lastLSN < firstLSN-1 {
+		w.lastLSN = firstLSN - 1
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("read wal segment %s: %w", path, err)
+		}
+
+		rec, decodeErr := decodeWALLine(line)
+		if decodeErr != nil {
+			// A broken record at the very end of the log is a write that was interrupted by a crash,
+			// and it was never acknowledged. Anything else means the log was damaged.
+			if isLast && isTail(reader) {
+				log.Printf("Truncating torn write at the end of wal segment %s: %v", path, decodeErr)
+				return os.Truncate(path, offset)
+			}
+			return fmt.Errorf("%w: segment %s at offset %d: %v", ErrWALCorrupted, path, offset, decodeErr)
+		}
+		if rec.LSN != w.lastLSN+1 {
+			return fmt.Errorf("%w: expected lsn %d, got %d in segment %s", ErrWALCorrupted, w.lastLSN+1, rec.LSN, path)
+		}
+
+		if err := replay(rec); err != nil {
+			return fmt.Errorf("replay wal record %d: %w", rec.LSN, err)
+		}
+		w.lastLSN = rec.LSN
+		offset += int64(len(line))
+	}
+}
+
+func decodeWALLine(line []byte) (walRecord, error) {
+	var rec walRecord
+
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		return rec, errors.New("record is not terminated")
+	}
+	checksum, payload, ok := strings.Cut(string(line[:len(line)-1]), " ")
+	if !ok {
+		return rec, errors.New("record has no checksum")
+	}
+	expected, err := strconv.ParseUint(checksum, 16, 32)
+	if err != nil {
+		return rec, fmt.Errorf("invalid checksum: %w", err)
+	}
+	if crc32.ChecksumIEEE([]byte(payload)) != uint32(expected) {
+		return rec, errors.New("checksum mismatch")
+	}
+	if err := json.Unmarshal([]byte(payload), &rec); err != nil {
+		return rec, fmt.Errorf("invalid payload: %w", err)
+	}
+	return rec, nil
+}
+
+// isTail reports whether there's nothing left to read after the current record
+func isTail(reader *bufio.Reader) bool {
+	_, err := reader.Peek(1)
+	return err == io.EOF
+}
+
+// segments returns the first LSNs of all segment files in ascending order
+func (w *WAL) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read wal dir: %w", err)
+	}
+
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, walSegmentExt) {
+			continue
+		}
+		firstLSN, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, firstLSN)
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func (w *WAL) segmentPath(firstLSN uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", firstLSN, walSegmentExt))
+}
+
+// syncDir fsyncs a directory so that newly created or renamed files in it survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open dir: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync dir: %w", err)
+	}
+	return nil
+}
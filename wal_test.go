@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWAL_TornWrite(t *testing.T) {
+	// tornWrite writes half of the line before failing, like a write interrupted by a full disk
+	tornWrite := func(file *os.File, line string) (int, error) {
+		n, _ := file.WriteString(line[:len(line)/2])
+		return n, errors.New("no space left on device")
+	}
+	replayAll := func(t *testing.T, dir string) []walRecord {
+		var records []walRecord
+		wal, err := OpenWAL(dir, WALOptions{}, func(rec walRecord) error {
+			records = append(records, rec)
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, wal.Close())
+		return records
+	}
+
+	t.Run("a failed write is cut from the segment, and its LSN is reused", func(t *testing.T) {
+		dir := t.TempDir()
+		wal, err := OpenWAL(dir, WALOptions{}, func(walRecord) error { return nil })
+		require.NoError(t, err)
+
+		_, err = wal.Append(walRecord{Type: walRecordProcessed, EventIDs: []string{"event-1"}})
+		require.NoError(t, err)
+
+		wal.writeLine = tornWrite
+		_, err = wal.Append(walRecord{Type: walRecordProcessed, EventIDs: []string{"event-2"}})
+		require.Error(t, err)
+
+		wal.writeLine = (*os.File).WriteString
+		lsn, err := wal.Append(walRecord{Type: walRecordProcessed, EventIDs: []string{"event-3"}})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), lsn)
+		require.NoError(t, wal.Close())
+
+		records := replayAll(t, dir)
+		require.Len(t, records, 2)
+		assert.Equal(t, []string{"event-1"}, records[0].EventIDs)
+		assert.Equal(t, []string{"event-3"}, records[1].EventIDs)
+	})
+
+	t.Run("the log fails if the torn write can't be cut", func(t *testing.T) {
+		dir := t.TempDir()
+		wal, err := OpenWAL(dir, WALOptions{}, func(walRecord) error { return nil })
+		require.NoError(t, err)
+
+		_, err = wal.Append(walRecord{Type: walRecordProcessed, EventIDs: []string{"event-1"}})
+		require.NoError(t, err)
+
+		// Truncating a file opened read-only fails
+		file := wal.file
+		readOnly, err := os.Open(file.Name())
+		require.NoError(t, err)
+		wal.file = readOnly
+		wal.writeLine = func(*os.File, string) (int, error) {
+			n, _ := file.WriteString("0000")
+			return n, errors.New("no space left on device")
+		}
+		_, err = wal.Append(walRecord{Type: walRecordProcessed, EventIDs: []string{"event-2"}})
+		require.Error(t, err)
+
+		wal.writeLine = (*os.File).WriteString
+		_, err = wal.Append(walRecord{Type: walRecordProcessed, EventIDs: []string{"event-3"}})
+		assert.ErrorContains(t, err, "torn record")
+
+		wal.file = file
+		readOnly.Close()
+		require.NoError(t, wal.Close())
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Window is a calendar period a leaderboard is limited to
+type Window string
+
+const (
+	WindowAllTime Window = "all_time"
+	WindowDaily   Window = "daily"
+	// WindowWeekly is the ISO week, starting on Monday
+	WindowWeekly  Window = "weekly"
+	WindowMonthly Window = "monthly"
+)
+
+// Windows is the list of all windows
+var Windows = []Window{WindowAllTime, WindowDaily, WindowWeekly, WindowMonthly}
+
+func ParseWindow(s string) (Window, error) {
+	for _, window := range Windows {
+		if Window(s) == window {
+			return window, nil
+		}
+	}
+	return "", fmt.Errorf("unknown window %q, must be one of: all_time, daily, weekly, monthly", s)
+}
+
+// Bounds returns the start (inclusive) and end (exclusive) of the window that contains t, in the given location.
+// The all-time window has zero bounds.
+func (w Window) Bounds(t time.Time, loc *time.Location) (time.Time, time.Time) {
+	t = t.In(loc)
+	year, month, day := t.Date()
+
+	// time.Date normalizes overflowing days and months, and takes care of DST changes
+	switch w {
+	case WindowDaily:
+		start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+		return start, time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+	case WindowWeekly:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		start := time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, loc)
+		return start, time.Date(year, month, day-daysSinceMonday+7, 0, 0, 0, 0, loc)
+	case WindowMonthly:
+		start := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+		return start, time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+	}
+	return time.Time{}, time.Time{}
+}